@@ -2,60 +2,201 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
 
 	"github.com/yarlson/ftl/pkg/build"
+	"github.com/yarlson/ftl/pkg/config"
 	"github.com/yarlson/ftl/pkg/console"
 	"github.com/yarlson/ftl/pkg/executor/local"
+	"github.com/yarlson/ftl/pkg/executor/ssh"
+	"github.com/yarlson/ftl/pkg/multierror"
 )
 
 var (
-	noPush bool
+	noPush        bool
+	buildParallel int
+	buildVerbose  bool
 
 	buildCmd = &cobra.Command{
 		Use:   "build",
 		Short: "Build your application Docker images",
 		Long: `Build your application Docker images as defined in ftl.yaml.
 This command handles the entire build process, including
-building and pushing the Docker images to the registry.`,
-		Run: runBuild,
+building and pushing the Docker images to the registry.
+Services with build mode "load" are built but not pushed, and
+services with build mode "remote" are built on the servers by
+'ftl deploy'. Images are built for the platforms of the servers,
+detected over SSH, unless build.platforms is set. Services are
+built in parallel; a failed build shows the end of its output,
+and --verbose streams the output of every build as it runs.
+In a git repository, images are also tagged with the commit,
+suffixed with -dirty for uncommitted changes, and with the
+version of a release tag like v1.2.3 pointing at the commit.`,
+		RunE: runBuild,
 	}
 )
 
 func init() {
 	rootCmd.AddCommand(buildCmd)
 	buildCmd.Flags().BoolVar(&noPush, "no-push", false, "Build images without pushing to registry")
+	buildCmd.Flags().IntVar(&buildParallel, "parallel", 4, "Number of images to build at once")
+	buildCmd.Flags().BoolVar(&buildVerbose, "verbose", false, "Print the build output of every service as it's produced")
 }
 
-func runBuild(cmd *cobra.Command, args []string) {
+func runBuild(cmd *cobra.Command, args []string) error {
 	cfg, err := parseConfig("ftl.yaml")
 	if err != nil {
-		console.ErrPrintln("Failed to parse config file:", err)
-		return
+		return configError(err)
+	}
+
+	if buildParallel < 1 {
+		return configError(fmt.Errorf("--parallel must be at least 1"))
 	}
 
 	executor := local.NewExecutor()
 	builder := build.NewBuild(executor)
+	builder.Verbose = buildVerbose
 
-	ctx := context.Background()
+	ctx := cmd.Context()
 
-	for _, service := range cfg.Services {
-		if err := builder.Build(ctx, service.Image, service.Path); err != nil {
-			console.ErrPrintf("Failed to build image for service %s: %v\n", service.Name, err)
+	revision, err := build.GitRevision(ctx, ".")
+	if err != nil {
+		console.Warning(fmt.Sprintf("Images are not tagged with the git revision: %v", err))
+	}
+	if revision != nil {
+		builder.Tags = revision.Tags()
+		console.Info(fmt.Sprintf("Tagging images with %s", strings.Join(builder.Tags, ", ")))
+	}
+
+	platforms, err := buildPlatforms(cfg, func() []string { return serverPlatforms(ctx, cfg) })
+	if err != nil {
+		return configError(err)
+	}
+
+	// Failures are collected per service and reported in the order of ftl.yaml,
+	// whatever order the builds finish in.
+	failures := make([]error, len(cfg.Services))
+	slots := make(chan struct{}, buildParallel)
+	var wg sync.WaitGroup
+
+	for i, service := range cfg.Services {
+		if service.BuildMode() == config.BuildRemote {
+			console.Info(fmt.Sprintf("Service %s is built on the servers during deploy.", service.Name))
 			continue
 		}
-		if !noPush {
-			if err := builder.Push(ctx, service.Image); err != nil {
-				console.ErrPrintf("Failed to push image for service %s: %v\n", service.Name, err)
-				continue
+
+		push := !noPush && service.BuildMode() == config.BuildRegistry
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			if err := builder.Build(ctx, &service, platforms[i], push); err != nil {
+				console.ErrPrintf("Failed to build image for service %s: %v\n", service.Name, err)
+				failures[i] = err
 			}
-		}
+		}()
+	}
+	wg.Wait()
+
+	var errs multierror.Error
+	for i, service := range cfg.Services {
+		errs.Add(service.Name, failures[i])
 	}
 
-	message := "Build process completed successfully."
 	if noPush {
-		message += " Images were not pushed due to --no-push flag."
+		console.Info("Images were not pushed due to --no-push flag.")
 	}
-	console.Success(message)
+
+	return summarize("Build", "services", len(cfg.Services), &errs)
+}
+
+// buildPlatforms returns the platforms each service is built for, in the order of
+// ftl.yaml: those in build.platforms, or else the platforms of the servers, which
+// detect is called once for. Services built on the servers get none. A loaded
+// image can only be for one platform, so servers of several platforms need their
+// images pushed to a registry or built on them.
+func buildPlatforms(cfg *config.Config, detect func() []string) ([][]string, error) {
+	var detected []string
+	platforms := make([][]string, len(cfg.Services))
+	for i, service := range cfg.Services {
+		if service.BuildMode() == config.BuildRemote {
+			continue
+		}
+
+		if service.Build != nil {
+			platforms[i] = service.Build.Platforms
+		}
+		if len(platforms[i]) == 0 {
+			if detected == nil {
+				detected = detect()
+			}
+			platforms[i] = detected
+		}
+
+		if service.BuildMode() == config.BuildLoad && len(platforms[i]) > 1 {
+			return nil, fmt.Errorf("service %s: build mode load supports a single platform, but the servers run %s; use build mode registry or remote for them",
+				service.Name, strings.Join(platforms[i], ", "))
+		}
+	}
+
+	return platforms, nil
+}
+
+// serverPlatforms returns the platforms of the servers, read with uname -m. Servers
+// that can't be reached are left out with a warning, and the default platform is
+// used when none could be.
+func serverPlatforms(ctx context.Context, cfg *config.Config) []string {
+	seen := make(map[string]bool)
+	var platforms []string
+	for _, server := range cfg.Servers {
+		platform, err := serverPlatform(ctx, server)
+		if err != nil {
+			console.Warning(fmt.Sprintf("Failed to detect the platform of server %s: %v", server.Host, err))
+			continue
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+
+	if len(platforms) == 0 {
+		console.Warning(fmt.Sprintf("Building for %s; set build.platforms to build for other platforms", build.DefaultPlatform))
+		return []string{build.DefaultPlatform}
+	}
+	sort.Strings(platforms)
+
+	return platforms
+}
+
+func serverPlatform(ctx context.Context, server config.Server) (string, error) {
+	sshKeyPath := filepath.Join(os.Getenv("HOME"), ".ssh", filepath.Base(server.SSHKey))
+	client, _, err := ssh.FindKeyAndConnectWithUser(server.Host, server.Port, server.User, sshKeyPath)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	output, err := client.RunCommand(ctx, "uname", "-m")
+	if err != nil {
+		return "", err
+	}
+
+	machine, err := io.ReadAll(output)
+	if err != nil {
+		return "", err
+	}
+
+	return build.Platform(string(machine))
 }
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestBuildPlatforms(t *testing.T) {
+	cfg := &config.Config{Services: []config.Service{
+		{Name: "web"},
+		{Name: "api", Build: &config.Build{Platforms: []string{"linux/arm64"}}},
+		{Name: "worker", Build: &config.Build{Mode: config.BuildRemote}},
+		{Name: "admin", Build: &config.Build{Mode: config.BuildLoad}},
+	}}
+
+	detections := 0
+	detect := func(platforms ...string) func() []string {
+		return func() []string {
+			detections++
+			return platforms
+		}
+	}
+
+	platforms, err := buildPlatforms(cfg, detect("linux/amd64"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"linux/amd64"}, {"linux/arm64"}, nil, {"linux/amd64"}}, platforms)
+	assert.Equal(t, 1, detections)
+
+	_, err = buildPlatforms(cfg, detect("linux/amd64", "linux/arm64"))
+	assert.EqualError(t, err, "service admin: build mode load supports a single platform, but the servers run linux/amd64, linux/arm64; use build mode registry or remote for them")
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+var (
+	dumpTo   string
+	dumpFrom string
+
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Dump and restore databases running as dependencies",
+		Long: `Dump and restore the database in a dependency with its own tools,
+which unlike a volume backup gives a consistent copy of a live
+database. Supported images are postgres, mysql, mariadb, redis and
+mongo; credentials are taken from the dependency's env.`,
+	}
+
+	dbDumpCmd = &cobra.Command{
+		Use:   "dump <dependency>",
+		Short: "Download a dump of a database",
+		Long: `Dump the database in a dependency on every server and stream it to
+the local machine. The dump is written to the current directory unless
+--to names another directory or a file.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runDBDump,
+	}
+
+	dbRestoreCmd = &cobra.Command{
+		Use:   "restore <dependency>",
+		Short: "Load a dump into a database",
+		Long: `Load a dump taken by 'ftl db dump' into the database in a dependency
+on all servers. Objects in the dump replace existing ones. Redis is
+restarted on the dump, which replaces its whole dataset.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runDBRestore,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbDumpCmd)
+	dbCmd.AddCommand(dbRestoreCmd)
+	dbDumpCmd.Flags().StringVar(&dumpTo, "to", ".", "Directory or file to write the dump to")
+	dbRestoreCmd.Flags().StringVar(&dumpFrom, "from", "", "Dump to restore")
+	_ = dbRestoreCmd.MarkFlagRequired("from")
+}
+
+func runDBDump(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	dependency, db, err := findDatabase(cfg, args[0])
+	if err != nil {
+		return configError(err)
+	}
+
+	toDir := isDir(dumpTo)
+	if !toDir && len(cfg.Servers) > 1 {
+		return configError(fmt.Errorf("--to must be a directory when dumping from %d servers", len(cfg.Servers)))
+	}
+
+	now := time.Now().UTC()
+	return forEachServer(cfg, "Database dump", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		path := dumpTo
+		if toDir {
+			path = filepath.Join(dumpTo, backupFileName(cfg, dependency.Name, server.Host, db.Extension, now))
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create dump file: %w", err)
+		}
+
+		err = deploy.DumpDatabase(cmd.Context(), dependency, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+			return deployError(err)
+		}
+
+		console.Success(fmt.Sprintf("Database %s on server %s dumped to %s", dependency.Name, server.Host, path))
+		return nil
+	})
+}
+
+func runDBRestore(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	dependency, _, err := findDatabase(cfg, args[0])
+	if err != nil {
+		return configError(err)
+	}
+
+	if _, err := os.Stat(dumpFrom); err != nil {
+		return configError(fmt.Errorf("dump %s can't be read: %w", dumpFrom, err))
+	}
+
+	return forEachServer(cfg, "Database restore", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		file, err := os.Open(dumpFrom)
+		if err != nil {
+			return fmt.Errorf("failed to open dump: %w", err)
+		}
+		defer file.Close()
+
+		if err := deploy.RestoreDatabase(cmd.Context(), cfg.Project.Name, dependency, file); err != nil {
+			return deployError(err)
+		}
+
+		console.Success(fmt.Sprintf("Database %s on server %s restored from %s", dependency.Name, server.Host, dumpFrom))
+		return nil
+	})
+}
+
+// findDatabase returns the dependency with the given name along with how its
+// database is dumped, or an error when it isn't defined or isn't a database.
+func findDatabase(cfg *config.Config, name string) (*config.Dependency, *deployment.Database, error) {
+	for i := range cfg.Dependencies {
+		if cfg.Dependencies[i].Name != name {
+			continue
+		}
+
+		db, err := deployment.NewDatabase(&cfg.Dependencies[i])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &cfg.Dependencies[i], db, nil
+	}
+
+	return nil, nil, fmt.Errorf("dependency %s is not defined in ftl.yaml", name)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+func TestFindDatabase(t *testing.T) {
+	cfg := &config.Config{
+		Dependencies: []config.Dependency{
+			{Name: "postgres", Image: "postgres:16"},
+			{Name: "search", Image: "elasticsearch:8"},
+		},
+	}
+
+	dependency, db, err := findDatabase(cfg, "postgres")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", dependency.Name)
+	assert.Equal(t, deployment.DatabasePostgres, db.Engine)
+
+	_, _, err = findDatabase(cfg, "search")
+	assert.ErrorContains(t, err, "is not a database ftl can dump")
+
+	_, _, err = findDatabase(cfg, "redis")
+	assert.EqualError(t, err, "dependency redis is not defined in ftl.yaml")
+}
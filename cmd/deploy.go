@@ -1,15 +1,28 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yarlson/ftl/pkg/build"
 	"github.com/yarlson/ftl/pkg/config"
 	"github.com/yarlson/ftl/pkg/console"
 	"github.com/yarlson/ftl/pkg/deployment"
 	"github.com/yarlson/ftl/pkg/executor/ssh"
+	"github.com/yarlson/ftl/pkg/multierror"
+)
+
+var (
+	lockWait             time.Duration
+	onlyServices         []string
+	recreateDependencies []string
+	skipDependencies     bool
+	skipProxy            bool
+	noPin                bool
 )
 
 var deployCmd = &cobra.Command{
@@ -17,30 +30,78 @@ var deployCmd = &cobra.Command{
 	Short: "Deploy your application to configured servers",
 	Long: `Deploy your application to all servers defined in ftl.yaml.
 This command handles the entire deployment process, ensuring
-zero-downtime updates of your services.`,
-	Run: runDeploy,
+zero-downtime updates of your services.
+
+Image tags of services pulled from a registry are resolved to a
+digest once, before deploying, so every server runs the same image
+even when the tag moves. Each server records the release, which
+'ftl release ls' shows.`,
+	RunE: runDeploy,
 }
 
 func init() {
 	rootCmd.AddCommand(deployCmd)
+	deployCmd.Flags().DurationVar(&lockWait, "wait", 0, "Wait up to this long for another deploy to release the lock")
+	deployCmd.Flags().StringSliceVar(&onlyServices, "service", nil, "Deploy only this service or dependency (repeatable)")
+	deployCmd.Flags().StringSliceVar(&recreateDependencies, "recreate-dependency", nil, "Replace this dependency even though it holds state (repeatable)")
+	deployCmd.Flags().BoolVar(&skipDependencies, "skip-dependencies", false, "Leave dependencies untouched")
+	deployCmd.Flags().BoolVar(&skipProxy, "skip-proxy", false, "Leave the proxy untouched")
+	deployCmd.Flags().BoolVar(&noPin, "no-pin", false, "Deploy image tags as they are instead of pinning them to a digest")
 }
 
-func runDeploy(cmd *cobra.Command, args []string) {
+func runDeploy(cmd *cobra.Command, args []string) error {
 	cfg, err := parseConfig("ftl.yaml")
 	if err != nil {
-		console.ErrPrintln("Failed to parse config file:", err)
-		return
+		return configError(err)
+	}
+
+	if err := checkServices(cfg, onlyServices); err != nil {
+		return configError(err)
+	}
+
+	if err := checkDependencies(cfg, recreateDependencies, skipDependencies); err != nil {
+		return configError(err)
+	}
+
+	ctx := cmd.Context()
+
+	if !noPin {
+		if err := console.ProgressSpinner(ctx, "Resolving image digests", "Image digests resolved", []func() error{
+			func() error {
+				return pinImages(cfg, onlyServices, func(image string) (string, error) { return build.Digest(ctx, image) })
+			},
+		}); err != nil {
+			return deployError(fmt.Errorf("%w; use --no-pin to deploy the tags as they are", err))
+		}
+	}
+
+	var revision string
+	if rev, err := build.GitRevision(ctx, "."); err == nil && rev != nil {
+		revision = rev.String()
 	}
 
+	var errs multierror.Error
 	for _, server := range cfg.Servers {
-		if err := deployToServer(cfg.Project.Name, cfg, server); err != nil {
+		if ctx.Err() != nil {
+			errs.Add(server.Host, fmt.Errorf("skipped: %w", ctx.Err()))
+			continue
+		}
+
+		start := time.Now()
+		console.Emit(console.Event{Type: console.EventDeployStarted, Server: server.Host})
+
+		if err := deployToServer(ctx, cfg.Project.Name, cfg, server, revision); err != nil {
+			console.Emit(console.Event{Type: console.EventDeployFinished, Server: server.Host, Duration: console.Since(start), Error: err.Error()})
 			console.ErrPrintln(fmt.Sprintf("Failed to deploy to server %s:", server.Host), err)
+			errs.Add(server.Host, err)
 			continue
 		}
+
+		console.Emit(console.Event{Type: console.EventDeployFinished, Server: server.Host, Duration: console.Since(start)})
 		console.Success(fmt.Sprintf("Successfully deployed to server %s", server.Host))
 	}
 
-	console.Success("Deployment completed successfully.")
+	return summarize("Deployment", "servers", len(cfg.Servers), &errs)
 }
 
 func parseConfig(filename string) (*config.Config, error) {
@@ -57,7 +118,7 @@ func parseConfig(filename string) (*config.Config, error) {
 	return cfg, nil
 }
 
-func deployToServer(project string, cfg *config.Config, server config.Server) error {
+func deployToServer(ctx context.Context, project string, cfg *config.Config, server config.Server, revision string) error {
 	console.Info(fmt.Sprintf("Deploying to server %s...", server.Host))
 
 	sshKeyPath := filepath.Join(os.Getenv("HOME"), ".ssh", filepath.Base(server.SSHKey))
@@ -68,9 +129,95 @@ func deployToServer(project string, cfg *config.Config, server config.Server) er
 	defer client.Close()
 
 	deploy := deployment.NewDeployment(client)
+	deploy.LockWait = lockWait
+	deploy.Services = onlyServices
+	deploy.RecreateDependencies = recreateDependencies
+	deploy.SkipDependencies = skipDependencies
+	deploy.SkipProxy = skipProxy
+	deploy.Revision = revision
+
+	if err := deploy.Deploy(ctx, project, cfg); err != nil {
+		return deployError(fmt.Errorf("deployment failed: %w", err))
+	}
+
+	return nil
+}
+
+// checkServices makes sure every name passed with --service is a service or
+// dependency defined in the config.
+func checkServices(cfg *config.Config, names []string) error {
+	defined := make(map[string]bool)
+	for _, service := range cfg.Services {
+		defined[service.Name] = true
+	}
+	for _, dependency := range cfg.Dependencies {
+		defined[dependency.Name] = true
+	}
 
-	if err := deploy.Deploy(project, cfg); err != nil {
-		return fmt.Errorf("deployment failed: %w", err)
+	for _, name := range names {
+		if !defined[name] {
+			return fmt.Errorf("service %s is not defined in ftl.yaml", name)
+		}
+	}
+
+	return nil
+}
+
+// checkDependencies makes sure every name passed with --recreate-dependency is a
+// dependency defined in the config that this deploy doesn't skip.
+func checkDependencies(cfg *config.Config, names []string, skip bool) error {
+	if len(names) > 0 && skip {
+		return fmt.Errorf("--recreate-dependency can't be combined with --skip-dependencies")
+	}
+
+	for _, name := range names {
+		found := false
+		for _, dependency := range cfg.Dependencies {
+			if dependency.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("dependency %s is not defined in ftl.yaml", name)
+		}
+	}
+
+	return nil
+}
+
+// pinImages replaces the images of the selected services that are pulled from a
+// registry with their digest, resolved once, so every server runs the same image.
+// Jobs running the image of a service are pinned along with it.
+func pinImages(cfg *config.Config, names []string, digest func(image string) (string, error)) error {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	pinned := make(map[string]string)
+	for i := range cfg.Services {
+		service := &cfg.Services[i]
+		if service.BuildMode() != config.BuildRegistry || build.IsPinned(service.Image) {
+			continue
+		}
+		if len(names) > 0 && !selected[service.Name] {
+			continue
+		}
+
+		if _, ok := pinned[service.Image]; !ok {
+			resolved, err := digest(service.Image)
+			if err != nil {
+				return err
+			}
+			pinned[service.Image] = build.Pinned(service.Image, resolved)
+		}
+		service.Image = pinned[service.Image]
+	}
+
+	for i := range cfg.Jobs {
+		if image, ok := pinned[cfg.Jobs[i].Image]; ok {
+			cfg.Jobs[i].Image = image
+		}
 	}
 
 	return nil
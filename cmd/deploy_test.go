@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestCheckServices(t *testing.T) {
+	cfg := &config.Config{
+		Services:     []config.Service{{Name: "api"}, {Name: "worker"}},
+		Dependencies: []config.Dependency{{Name: "postgres"}},
+	}
+
+	assert.NoError(t, checkServices(cfg, nil))
+	assert.NoError(t, checkServices(cfg, []string{"api", "postgres"}))
+	assert.EqualError(t, checkServices(cfg, []string{"api", "web"}), "service web is not defined in ftl.yaml")
+}
+
+func TestCheckDependencies(t *testing.T) {
+	cfg := &config.Config{
+		Services:     []config.Service{{Name: "api"}},
+		Dependencies: []config.Dependency{{Name: "postgres"}},
+	}
+
+	assert.NoError(t, checkDependencies(cfg, nil, true))
+	assert.NoError(t, checkDependencies(cfg, []string{"postgres"}, false))
+	assert.EqualError(t, checkDependencies(cfg, []string{"api"}, false), "dependency api is not defined in ftl.yaml")
+	assert.Error(t, checkDependencies(cfg, []string{"postgres"}, true))
+}
+
+func TestPinImages(t *testing.T) {
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Services: []config.Service{
+				{Name: "web", Image: "registry.example.com/web:latest"},
+				{Name: "worker", Image: "registry.example.com/web:latest"},
+				{Name: "api", Image: "api:latest", Build: &config.Build{Mode: config.BuildRemote}},
+				{Name: "admin", Image: "registry.example.com/admin@sha256:fixed"},
+			},
+			Jobs: []config.Job{{Name: "migrate", Image: "registry.example.com/web:latest"}},
+		}
+	}
+
+	var resolved []string
+	digest := func(image string) (string, error) {
+		resolved = append(resolved, image)
+		return "sha256:1234", nil
+	}
+
+	cfg := newConfig()
+	require.NoError(t, pinImages(cfg, nil, digest))
+	assert.Equal(t, []string{"registry.example.com/web:latest"}, resolved, "each image is resolved once")
+	assert.Equal(t, "registry.example.com/web@sha256:1234", cfg.Services[0].Image)
+	assert.Equal(t, "registry.example.com/web@sha256:1234", cfg.Services[1].Image)
+	assert.Equal(t, "api:latest", cfg.Services[2].Image)
+	assert.Equal(t, "registry.example.com/admin@sha256:fixed", cfg.Services[3].Image)
+	assert.Equal(t, "registry.example.com/web@sha256:1234", cfg.Jobs[0].Image)
+
+	cfg = newConfig()
+	require.NoError(t, pinImages(cfg, []string{"api"}, digest))
+	assert.Equal(t, "registry.example.com/web:latest", cfg.Services[0].Image, "unselected services aren't pinned")
+
+	cfg = newConfig()
+	err := pinImages(cfg, nil, func(string) (string, error) { return "", errors.New("unauthorized") })
+	assert.EqualError(t, err, "unauthorized")
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/executor/ssh"
+	"github.com/yarlson/ftl/pkg/multierror"
+)
+
+// Exit codes returned by the ftl binary. When several failures are aggregated, the
+// highest code wins.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1
+	ExitConfig     = 2
+	ExitConnection = 3
+	ExitDeploy     = 4
+
+	// ExitInterrupted follows the shell convention of 128 plus SIGINT.
+	ExitInterrupted = 130
+)
+
+// exitError tags an error with the exit code it should produce.
+type exitError struct {
+	code     int
+	err      error
+	reported bool
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func configError(err error) error {
+	return &exitError{code: ExitConfig, err: err}
+}
+
+func deployError(err error) error {
+	return &exitError{code: ExitDeploy, err: err}
+}
+
+// ExitCode returns the process exit code for an error returned by Execute.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	// Aggregated failures come first: errors.Is and errors.As would stop at the
+	// first failure that matches rather than pick the highest code. A code the
+	// aggregate itself was tagged with, such as by deployError, still counts.
+	var multiErr *multierror.Error
+	if errors.As(err, &multiErr) {
+		code := ExitFailure
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		}
+		for _, failure := range multiErr.Failures {
+			code = max(code, ExitCode(failure.Err))
+		}
+		return code
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ExitInterrupted
+	}
+
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+
+	var connErr *ssh.ConnectionError
+	if errors.As(err, &connErr) {
+		return ExitConnection
+	}
+
+	return ExitFailure
+}
+
+// summarize prints how many targets, such as servers or services, an operation
+// succeeded on and lists the failures. It returns the aggregated error.
+func summarize(operation, targets string, total int, errs *multierror.Error) error {
+	failed := len(errs.Failures)
+
+	if failed == 0 {
+		console.Success(fmt.Sprintf("%s completed successfully for %d of %d %s.", operation, total, total, targets))
+		return nil
+	}
+
+	console.ErrPrintln(fmt.Sprintf("%s failed for %d of %d %s:", operation, failed, total, targets))
+	for _, failure := range errs.Failures {
+		console.ErrPrintln(fmt.Sprintf("  %s: %v", failure.Target, failure.Err))
+	}
+
+	return &exitError{code: ExitCode(errs), err: errs, reported: true}
+}
+
+// report prints err unless it was already printed by summarize.
+func report(err error) {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) && exitErr.reported {
+		return
+	}
+
+	console.ErrPrintln("Error:", err)
+}
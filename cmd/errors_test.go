@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yarlson/ftl/pkg/executor/ssh"
+	"github.com/yarlson/ftl/pkg/multierror"
+)
+
+func TestExitCode(t *testing.T) {
+	connErr := fmt.Errorf("failed to connect to server: %w", &ssh.ConnectionError{Host: "a.example.com", Err: errors.New("timeout")})
+
+	mixed := &multierror.Error{}
+	mixed.Add("a.example.com", connErr)
+	mixed.Add("b.example.com", deployError(errors.New("proxy failed")))
+
+	configFirst := &multierror.Error{}
+	configFirst.Add("a.example.com", configError(errors.New("invalid")))
+	configFirst.Add("b.example.com", connErr)
+	configFirst.Add("c.example.com", deployError(errors.New("unhealthy")))
+
+	cancelledLast := &multierror.Error{}
+	cancelledLast.Add("a.example.com", deployError(errors.New("unhealthy")))
+	cancelledLast.Add("b.example.com", fmt.Errorf("deployment failed: %w", context.Canceled))
+
+	deployFailures := &multierror.Error{}
+	deployFailures.Add("web", errors.New("unhealthy"))
+	deployFailures.Add("proxy", errors.New("config invalid"))
+
+	unreachable := &multierror.Error{}
+	unreachable.Add("a.example.com", connErr)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "success", err: nil, expected: ExitOK},
+		{name: "generic", err: errors.New("boom"), expected: ExitFailure},
+		{name: "config", err: configError(errors.New("invalid")), expected: ExitConfig},
+		{name: "connection", err: connErr, expected: ExitConnection},
+		{name: "deploy", err: deployError(errors.New("unhealthy")), expected: ExitDeploy},
+		{name: "all servers unreachable", err: unreachable, expected: ExitConnection},
+		{name: "highest code wins", err: mixed, expected: ExitDeploy},
+		{name: "highest code wins over the first failure", err: configFirst, expected: ExitDeploy},
+		{name: "wrapped failures", err: fmt.Errorf("volume list failed: %w", configFirst), expected: ExitDeploy},
+		{name: "tagged failures", err: deployError(fmt.Errorf("deployment failed: %w", deployFailures)), expected: ExitDeploy},
+		{name: "interrupted among tagged failures", err: deployError(fmt.Errorf("deployment failed: %w", cancelledLast)), expected: ExitInterrupted},
+		{name: "interrupted among failures", err: cancelledLast, expected: ExitInterrupted},
+		{name: "interrupted", err: deployError(fmt.Errorf("deployment failed: %w", context.Canceled)), expected: ExitInterrupted},
+		{name: "summarized", err: summarize("Deployment", "servers", 2, unreachable), expected: ExitConnection},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExitCode(tt.err))
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	assert.NoError(t, summarize("Deployment", "servers", 2, &multierror.Error{}))
+
+	errs := &multierror.Error{}
+	errs.Add("a.example.com", errors.New("boom"))
+	err := summarize("Deployment", "servers", 2, errs)
+	assert.ErrorIs(t, err, errs.Failures[0])
+	assert.ErrorContains(t, err, "a.example.com: boom")
+}
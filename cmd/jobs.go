@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+var (
+	historyLimit int
+
+	jobsCmd = &cobra.Command{
+		Use:   "jobs",
+		Short: "Run and inspect scheduled jobs",
+	}
+
+	jobsRunCmd = &cobra.Command{
+		Use:   "run <name>",
+		Short: "Run a job now",
+		Long: `Run a job defined in ftl.yaml right away on all servers, outside
+its schedule. The run is recorded in the job history.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runJobsRun,
+	}
+
+	jobsHistoryCmd = &cobra.Command{
+		Use:   "history [name]",
+		Short: "Show the last runs of jobs",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runJobsHistory,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(jobsCmd)
+	jobsCmd.AddCommand(jobsRunCmd)
+	jobsCmd.AddCommand(jobsHistoryCmd)
+	jobsHistoryCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Number of runs to show per server")
+}
+
+func runJobsRun(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	name := args[0]
+	if err := checkJob(cfg, name); err != nil {
+		return configError(err)
+	}
+
+	return forEachServer(cfg, "Job run", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		output, err := deploy.RunJob(cmd.Context(), name)
+		if output = strings.TrimSpace(output); output != "" {
+			console.Info(output)
+		}
+		if err != nil {
+			return deployError(err)
+		}
+
+		console.Success(fmt.Sprintf("Job %s finished on server %s", name, server.Host))
+		return nil
+	})
+}
+
+func runJobsHistory(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+		if err := checkJob(cfg, name); err != nil {
+			return configError(err)
+		}
+	}
+
+	return forEachServer(cfg, "Job history", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		runs, err := deploy.JobHistory(cmd.Context(), cfg.Project.Name, name, historyLimit)
+		if err != nil {
+			return err
+		}
+
+		if len(runs) == 0 {
+			console.Info(fmt.Sprintf("%s: no job runs recorded", server.Host))
+			return nil
+		}
+
+		for _, run := range runs {
+			status := "ok"
+			if run.ExitCode != 0 {
+				status = fmt.Sprintf("failed (exit %d)", run.ExitCode)
+			}
+			console.Info(fmt.Sprintf("%s: %s  %s  %s  %s", server.Host, run.Job,
+				run.StartedAt.Local().Format(time.RFC3339), run.FinishedAt.Sub(run.StartedAt), status))
+		}
+
+		return nil
+	})
+}
+
+func checkJob(cfg *config.Config, name string) error {
+	for _, job := range cfg.Jobs {
+		if job.Name == name {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("job %s is not defined in ftl.yaml", name)
+}
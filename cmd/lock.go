@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/deployment"
+	"github.com/yarlson/ftl/pkg/executor/ssh"
+	"github.com/yarlson/ftl/pkg/multierror"
+)
+
+var (
+	lockCmd = &cobra.Command{
+		Use:   "lock",
+		Short: "Inspect or break the deploy lock",
+		Long: `Every deploy holds a lock on each server while it runs, so that
+two deploys of the same project can't interfere with each other.`,
+	}
+
+	lockStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show who holds the deploy lock on each server",
+		RunE:  runLockStatus,
+	}
+
+	lockBreakCmd = &cobra.Command{
+		Use:   "break",
+		Short: "Remove the deploy lock on all servers",
+		Long: `Remove the deploy lock on all servers. Only use this when the deploy
+holding the lock is known to be gone; locks whose heartbeat is more than
+5 minutes old are broken automatically.`,
+		RunE: runLockBreak,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.AddCommand(lockStatusCmd)
+	lockCmd.AddCommand(lockBreakCmd)
+}
+
+func runLockStatus(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	return forEachServer(cfg, "Lock status", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		info, err := deploy.LockStatus(cmd.Context(), cfg.Project.Name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info == nil:
+			console.Info(fmt.Sprintf("%s: unlocked", server.Host))
+		case info.Owner == "":
+			console.Warning(fmt.Sprintf("%s: locked, holder unknown", server.Host))
+		case info.IsStale():
+			console.Warning(fmt.Sprintf("%s: locked by %s (stale)", server.Host, info))
+		default:
+			console.Warning(fmt.Sprintf("%s: locked by %s", server.Host, info))
+		}
+
+		return nil
+	})
+}
+
+func runLockBreak(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	return forEachServer(cfg, "Lock break", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		if err := deploy.ReleaseLock(cmd.Context(), cfg.Project.Name); err != nil {
+			return err
+		}
+
+		console.Success(fmt.Sprintf("%s: lock removed", server.Host))
+		return nil
+	})
+}
+
+// forEachServer connects to every server in the config and runs fn against it,
+// collecting the failures into a summary.
+func forEachServer(cfg *config.Config, operation string, fn func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error) error {
+	var errs multierror.Error
+	for _, server := range cfg.Servers {
+		sshKeyPath := filepath.Join(os.Getenv("HOME"), ".ssh", filepath.Base(server.SSHKey))
+		client, _, err := ssh.FindKeyAndConnectWithUser(server.Host, server.Port, server.User, sshKeyPath)
+		if err != nil {
+			console.ErrPrintln(fmt.Sprintf("Failed to connect to server %s:", server.Host), err)
+			errs.Add(server.Host, err)
+			continue
+		}
+
+		err = fn(cfg, server, deployment.NewDeployment(client))
+		client.Close()
+		if err != nil {
+			console.ErrPrintln(fmt.Sprintf("%s failed on server %s:", operation, server.Host), err)
+			errs.Add(server.Host, err)
+		}
+	}
+
+	return summarize(operation, "servers", len(cfg.Servers), &errs)
+}
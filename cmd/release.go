@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+var (
+	releaseLimit int
+
+	releaseCmd = &cobra.Command{
+		Use:   "release",
+		Short: "Inspect the releases recorded by deploys",
+	}
+
+	releaseLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List the releases recorded on every server",
+		Long: `List the releases recorded on every server, newest first. A release
+is recorded after each successful deploy, with who deployed which
+git revision and the exact image every service runs.`,
+		Args: cobra.NoArgs,
+		RunE: runReleaseLs,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(releaseCmd)
+	releaseCmd.AddCommand(releaseLsCmd)
+	releaseLsCmd.Flags().IntVarP(&releaseLimit, "limit", "n", 10, "Number of releases to show")
+}
+
+func runReleaseLs(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	return forEachServer(cfg, "Release list", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		releases, err := deploy.Releases(cmd.Context(), cfg.Project.Name, releaseLimit)
+		if err != nil {
+			return err
+		}
+
+		if len(releases) == 0 {
+			console.Info(fmt.Sprintf("%s: no releases recorded", server.Host))
+			return nil
+		}
+
+		for _, release := range releases {
+			console.Info(formatRelease(server.Host, release))
+		}
+
+		return nil
+	})
+}
+
+// formatRelease describes a release on one line per service, below a line with
+// when, by whom and from which revision it was deployed.
+func formatRelease(host string, release deployment.Release) string {
+	header := fmt.Sprintf("%s: %s  by %s", host, release.ID, release.DeployedBy)
+	if release.Revision != "" {
+		header += "  revision " + release.Revision
+	}
+
+	lines := []string{header}
+	for _, service := range release.Services {
+		lines = append(lines, fmt.Sprintf("  %s  %s", service.Name, service.Image))
+	}
+
+	return strings.Join(lines, "\n")
+}
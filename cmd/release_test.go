@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+func TestFormatRelease(t *testing.T) {
+	release := deployment.Release{
+		ID:         "20261018T120000.123Z-3f9a1c",
+		DeployedBy: "alice@laptop",
+		Revision:   "0f3c2a1b9e4d-dirty",
+		Services: []deployment.ReleaseService{
+			{Name: "web", Image: "registry.example.com/web@sha256:1234"},
+			{Name: "api", Image: "api:latest"},
+		},
+	}
+
+	assert.Equal(t, "example.com: 20261018T120000.123Z-3f9a1c  by alice@laptop  revision 0f3c2a1b9e4d-dirty\n"+
+		"  web  registry.example.com/web@sha256:1234\n"+
+		"  api  api:latest", formatRelease("example.com", release))
+
+	release.Revision = ""
+	release.Services = nil
+	assert.Equal(t, "example.com: 20261018T120000.123Z-3f9a1c  by alice@laptop", formatRelease("example.com", release))
+}
@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/console"
 )
 
+var outputFormat string
+
 var rootCmd = &cobra.Command{
 	Use:   "ftl",
 	Short: "FTL - Faster Than Light deployment tool",
@@ -13,9 +22,47 @@ to make deployment easy and reliable, even for developers who aren't experts
 in server management or advanced deployment techniques.
 
 Use 'ftl [command] --help' for more information about a command.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return console.SetOutput(outputFormat)
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", console.OutputText, "Output format: text, json or plain")
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
+// Errors are printed here; use ExitCode to turn the returned error into an exit code.
+//
+// The first interrupt cancels the context of the running command, which rolls back
+// the step in progress; a second one terminates right away.
 func Execute() error {
-	return rootCmd.Execute()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+
+		// Without a channel to deliver to, the next signal terminates the process.
+		signal.Stop(signals)
+		console.Warning("Interrupted, rolling back the step in progress. Press Ctrl-C again to quit immediately.")
+		cancel()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if err != nil {
+		report(err)
+	}
+
+	return err
 }
@@ -12,6 +12,7 @@ import (
 
 	"github.com/yarlson/ftl/pkg/config"
 	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/multierror"
 	"github.com/yarlson/ftl/pkg/setup"
 )
 
@@ -20,18 +21,17 @@ var setupCmd = &cobra.Command{
 	Short: "Prepare servers for deployment",
 	Long: `Setup configures servers defined in ftl.yaml for deployment.
 Run this once for each new server before deploying your application.`,
-	Run: runSetup,
+	RunE: runSetup,
 }
 
 func init() {
 	rootCmd.AddCommand(setupCmd)
 }
 
-func runSetup(cmd *cobra.Command, args []string) {
+func runSetup(cmd *cobra.Command, args []string) error {
 	cfg, err := parseConfig("ftl.yaml")
 	if err != nil {
-		console.ErrPrintln("Failed to parse config file:", err)
-		return
+		return configError(err)
 	}
 
 	var dockerUsername, dockerPassword string
@@ -48,15 +48,13 @@ func runSetup(cmd *cobra.Command, args []string) {
 		console.Input("Enter Docker Hub username:")
 		dockerUsername, err = console.ReadLine()
 		if err != nil {
-			console.ErrPrintln("Failed to read Docker Hub username:", err)
-			return
+			return fmt.Errorf("failed to read Docker Hub username: %w", err)
 		}
 
 		console.Input("Enter Docker Hub password:")
 		dockerPassword, err = console.ReadPassword()
 		if err != nil {
-			console.ErrPrintln("Failed to read Docker Hub password:", err)
-			return
+			return fmt.Errorf("failed to read Docker Hub password: %w", err)
 		}
 		fmt.Println()
 	}
@@ -64,30 +62,30 @@ func runSetup(cmd *cobra.Command, args []string) {
 	console.Input("Enter server user password:")
 	newUserPassword, err := console.ReadPassword()
 	if err != nil {
-		console.ErrPrintln("Failed to read password:", err)
-		return
+		return fmt.Errorf("failed to read password: %w", err)
 	}
 	fmt.Println()
 
 	if dockerUsername != "" && dockerPassword != "" {
 		if err := setup.DockerLogin(context.Background(), dockerUsername, dockerPassword); err != nil {
-			console.ErrPrintln("Failed to login to Docker Hub:", err)
-			return
+			return fmt.Errorf("failed to login to Docker Hub: %w", err)
 		}
 	}
 
+	var errs multierror.Error
 	for _, server := range cfg.Servers {
-		if err := setupServer(server, dockerUsername, dockerPassword, newUserPassword); err != nil {
+		if err := setupServer(cfg, server, dockerUsername, dockerPassword, newUserPassword); err != nil {
 			console.ErrPrintln(fmt.Sprintf("Failed to setup server %s:", server.Host), err)
+			errs.Add(server.Host, err)
 			continue
 		}
 		console.Success(fmt.Sprintf("Successfully set up server %s", server.Host))
 	}
 
-	console.Success("Server setup completed successfully.")
+	return summarize("Server setup", "servers", len(cfg.Servers), &errs)
 }
 
-func setupServer(server config.Server, dockerUsername, dockerPassword, newUserPassword string) error {
+func setupServer(cfg *config.Config, server config.Server, dockerUsername, dockerPassword, newUserPassword string) error {
 	console.Info(fmt.Sprintf("Setting up server %s...", server.Host))
 
 	sshKeyPath := filepath.Join(os.Getenv("HOME"), ".ssh", filepath.Base(server.SSHKey))
@@ -95,7 +93,7 @@ func setupServer(server config.Server, dockerUsername, dockerPassword, newUserPa
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	return setup.RunSetup(ctx, server, sshKeyPath, dockerUsername, dockerPassword, newUserPassword)
+	return setup.RunSetup(ctx, cfg, server, sshKeyPath, dockerUsername, dockerPassword, newUserPassword)
 }
 
 func imageFromDockerHub(image string) bool {
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+var (
+	rollbackTo string
+
+	staticCmd = &cobra.Command{
+		Use:   "static",
+		Short: "Manage static sites served by the proxy",
+	}
+
+	staticRollbackCmd = &cobra.Command{
+		Use:   "rollback <name>",
+		Short: "Roll a static site back to an earlier release",
+		Long: `Point a static site defined in ftl.yaml back to an earlier release
+on all servers. Without --to, the release deployed before the
+current one is used.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runStaticRollback,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(staticCmd)
+	staticCmd.AddCommand(staticRollbackCmd)
+	staticRollbackCmd.Flags().StringVar(&rollbackTo, "to", "", "Release to roll back to")
+}
+
+func runStaticRollback(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	name := args[0]
+	found := false
+	for _, static := range cfg.Static {
+		if static.Name == name {
+			found = true
+		}
+	}
+	if !found {
+		return configError(fmt.Errorf("static site %s is not defined in ftl.yaml", name))
+	}
+
+	return forEachServer(cfg, "Rollback", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		release, err := deploy.RollbackStatic(cmd.Context(), cfg.Project.Name, name, rollbackTo)
+		if err != nil {
+			return deployError(err)
+		}
+
+		console.Success(fmt.Sprintf("Rolled back %s to release %s on server %s", name, release, server.Host))
+		return nil
+	})
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/deployment"
+)
+
+var (
+	backupTo    string
+	restoreFrom string
+
+	volumeCmd = &cobra.Command{
+		Use:   "volume",
+		Short: "Inspect, back up and restore named volumes",
+	}
+
+	volumeLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List the volumes of the project with their size",
+		Args:  cobra.NoArgs,
+		RunE:  runVolumeLs,
+	}
+
+	volumeBackupCmd = &cobra.Command{
+		Use:   "backup <name>",
+		Short: "Download a volume as a gzipped tar",
+		Long: `Stream a gzipped tar of a volume from every server to the local
+machine. The archive is written to the current directory unless --to
+names another directory or a file. The volume is read while its
+containers keep running.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runVolumeBackup,
+	}
+
+	volumeRestoreCmd = &cobra.Command{
+		Use:   "restore <name>",
+		Short: "Replace the content of a volume with a backup",
+		Long: `Replace the content of a volume on all servers with a gzipped tar
+taken by 'ftl volume backup'. The containers using the volume are
+stopped during the restore and started again afterwards.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runVolumeRestore,
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(volumeCmd)
+	volumeCmd.AddCommand(volumeLsCmd)
+	volumeCmd.AddCommand(volumeBackupCmd)
+	volumeCmd.AddCommand(volumeRestoreCmd)
+	volumeBackupCmd.Flags().StringVar(&backupTo, "to", ".", "Directory or file to write the backup to")
+	volumeRestoreCmd.Flags().StringVar(&restoreFrom, "from", "", "Backup to restore")
+	_ = volumeRestoreCmd.MarkFlagRequired("from")
+}
+
+func runVolumeLs(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	return forEachServer(cfg, "Volume list", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		volumes, err := deploy.ListVolumes(cmd.Context(), cfg.Project.Name, cfg.Volumes)
+		if err != nil {
+			return err
+		}
+
+		if len(volumes) == 0 {
+			console.Info(fmt.Sprintf("%s: no volumes defined", server.Host))
+			return nil
+		}
+
+		for _, volume := range volumes {
+			switch {
+			case !volume.Created:
+				console.Info(fmt.Sprintf("%s: %s  not created", server.Host, volume.Name))
+			case volume.Size < 0:
+				console.Info(fmt.Sprintf("%s: %s  size unknown  used by %d containers", server.Host, volume.Name, volume.Containers))
+			default:
+				console.Info(fmt.Sprintf("%s: %s  %s  used by %d containers", server.Host, volume.Name, formatSize(volume.Size), volume.Containers))
+			}
+		}
+
+		return nil
+	})
+}
+
+func runVolumeBackup(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	name := args[0]
+	if _, err := findVolume(cfg, name); err != nil {
+		return configError(err)
+	}
+
+	toDir := isDir(backupTo)
+	if !toDir && len(cfg.Servers) > 1 {
+		return configError(fmt.Errorf("--to must be a directory when backing up from %d servers", len(cfg.Servers)))
+	}
+
+	now := time.Now().UTC()
+	return forEachServer(cfg, "Volume backup", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		path := backupTo
+		if toDir {
+			path = filepath.Join(backupTo, backupFileName(cfg, name, server.Host, ".tar.gz", now))
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create backup file: %w", err)
+		}
+
+		err = deploy.BackupVolume(cmd.Context(), cfg.Project.Name, name, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+			return deployError(err)
+		}
+
+		console.Success(fmt.Sprintf("Volume %s on server %s backed up to %s", name, server.Host, path))
+		return nil
+	})
+}
+
+func runVolumeRestore(cmd *cobra.Command, args []string) error {
+	cfg, err := parseConfig("ftl.yaml")
+	if err != nil {
+		return configError(err)
+	}
+
+	volume, err := findVolume(cfg, args[0])
+	if err != nil {
+		return configError(err)
+	}
+
+	if _, err := os.Stat(restoreFrom); err != nil {
+		return configError(fmt.Errorf("backup %s can't be read: %w", restoreFrom, err))
+	}
+
+	return forEachServer(cfg, "Volume restore", func(cfg *config.Config, server config.Server, deploy *deployment.Deployment) error {
+		file, err := os.Open(restoreFrom)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer file.Close()
+
+		if err := deploy.RestoreVolume(cmd.Context(), cfg.Project.Name, *volume, file); err != nil {
+			return deployError(err)
+		}
+
+		console.Success(fmt.Sprintf("Volume %s on server %s restored from %s", volume.Name, server.Host, restoreFrom))
+		return nil
+	})
+}
+
+func findVolume(cfg *config.Config, name string) (*config.Volume, error) {
+	for i := range cfg.Volumes {
+		if cfg.Volumes[i].Name == name {
+			return &cfg.Volumes[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("volume %s is not defined in ftl.yaml", name)
+}
+
+// backupFileName names a backup after the project, the volume or dependency and
+// the time it was taken. The server is included when there are several, so their
+// backups don't overwrite each other.
+func backupFileName(cfg *config.Config, source, host, extension string, takenAt time.Time) string {
+	name := cfg.Project.Name + "-" + source
+	if len(cfg.Servers) > 1 {
+		name += "-" + host
+	}
+
+	return fmt.Sprintf("%s-%s%s", name, takenAt.Format("20060102T150405Z"), extension)
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// formatSize formats a size in bytes with a binary unit, like 1.5 GiB.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestBackupFileName(t *testing.T) {
+	cfg := &config.Config{
+		Project: config.Project{Name: "my-project"},
+		Servers: []config.Server{{Host: "one.example.com"}},
+	}
+	takenAt := time.Date(2026, 10, 18, 14, 30, 5, 0, time.UTC)
+
+	assert.Equal(t, "my-project-db_data-20261018T143005Z.tar.gz", backupFileName(cfg, "db_data", "one.example.com", ".tar.gz", takenAt))
+
+	cfg.Servers = append(cfg.Servers, config.Server{Host: "two.example.com"})
+	assert.Equal(t, "my-project-db_data-two.example.com-20261018T143005Z.tar.gz", backupFileName(cfg, "db_data", "two.example.com", ".tar.gz", takenAt))
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.0 KiB", formatSize(1024))
+	assert.Equal(t, "1.5 MiB", formatSize(1536*1024))
+	assert.Equal(t, "2.0 GiB", formatSize(2<<30))
+}
+
+func TestFindVolume(t *testing.T) {
+	cfg := &config.Config{Volumes: []config.Volume{{Name: "db_data", Driver: "local"}}}
+
+	volume, err := findVolume(cfg, "db_data")
+	assert.NoError(t, err)
+	assert.Equal(t, "local", volume.Driver)
+
+	_, err = findVolume(cfg, "uploads")
+	assert.EqualError(t, err, "volume uploads is not defined in ftl.yaml")
+}
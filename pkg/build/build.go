@@ -1,67 +1,213 @@
 package build
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/yarlson/ftl/pkg/config"
 	"github.com/yarlson/ftl/pkg/console"
 )
 
+// DefaultPlatform is built for when the platform of the servers is unknown.
+const DefaultPlatform = "linux/amd64"
+
+// logTailLines is how much of the output of a failed build or push is added to
+// its error; the failing step is usually near the end.
+const logTailLines = 30
+
 type Executor interface {
 	RunCommand(ctx context.Context, command string, args ...string) (io.Reader, error)
+	RunCommandWithOutput(ctx context.Context, out io.Writer, command string, args ...string) error
 	RunCommandWithProgress(ctx context.Context, initialMsg, completeMsg string, commands []string) error
 }
 
 type Build struct {
 	executor Executor
+
+	// Verbose prints the output of builds and pushes as it's produced, each line
+	// prefixed with the service.
+	Verbose bool
+
+	// Tags are extra tags given to every image next to the one in ftl.yaml, such
+	// as the tags of the git revision.
+	Tags []string
 }
 
 func NewBuild(executor Executor) *Build {
 	return &Build{executor: executor}
 }
 
-func (b *Build) Build(ctx context.Context, image string, path string) error {
-	if err := console.ProgressSpinner(
-		context.Background(),
-		fmt.Sprintf("Building image %s", image), fmt.Sprintf("Image %s built", image),
-		[]func() error{
-			func() error { return b.buildImage(ctx, image, path) },
-		}); err != nil {
-		return fmt.Errorf("failed to create network: %w", err)
+// Build builds the image of the service for the platforms and pushes it when push
+// is set. An image for several platforms is pushed as it's built, so it can't be
+// built without pushing. Builds of different services may run concurrently.
+func (b *Build) Build(ctx context.Context, service *config.Service, platforms []string, push bool) error {
+	image := service.Image
+	if len(platforms) > 1 && !push {
+		return fmt.Errorf("image %s is built for %s and can only be pushed, not kept locally", image, strings.Join(platforms, ", "))
+	}
+
+	start := time.Now()
+	console.Info(fmt.Sprintf("Building image %s...", image))
+	if err := b.run(ctx, service.Name, Args(service, service.BuildContext(), platforms, push, b.Tags...)...); err != nil {
+		return fmt.Errorf("build failed: %w", err)
+	}
+	console.Success(fmt.Sprintf("Image %s built (%s)", image, time.Since(start).Round(time.Millisecond)))
+
+	if push && len(platforms) <= 1 {
+		images := []string{image}
+		for _, tag := range b.Tags {
+			images = append(images, Tagged(image, tag))
+		}
+
+		for _, image := range images {
+			if err := b.Push(ctx, service.Name, image); err != nil {
+				return fmt.Errorf("push failed: %w", err)
+			}
+		}
 	}
 
 	return nil
 }
 
-func (b *Build) buildImage(ctx context.Context, image, path string) error {
-	_, err := b.executor.RunCommand(ctx, "docker", "build", "-t", image, "--platform", "linux/amd64", path)
-	if err != nil {
-		return fmt.Errorf("failed to build image: %w", err)
+func (b *Build) Push(ctx context.Context, service, image string) error {
+	start := time.Now()
+	console.Info(fmt.Sprintf("Pushing image %s...", image))
+	if err := b.run(ctx, service, "push", image); err != nil {
+		return err
 	}
+	console.Success(fmt.Sprintf("Image %s pushed (%s)", image, time.Since(start).Round(time.Millisecond)))
 
 	return nil
 }
 
-func (b *Build) Push(ctx context.Context, image string) error {
-	if err := console.ProgressSpinner(
-		context.Background(),
-		fmt.Sprintf("Pushing image %s", image),
-		fmt.Sprintf("Image %s pushed", image),
-		[]func() error{
-			func() error { return b.pushImage(ctx, image) },
-		}); err != nil {
-		return fmt.Errorf("failed to push image: %w", err)
+// run runs docker with args, printing its output when Verbose is set. The end of
+// the output is added to the error, so a failure shows more than the exit status.
+func (b *Build) run(ctx context.Context, service string, args ...string) error {
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if b.Verbose {
+		lines := console.LineWriter(service)
+		defer lines.Close()
+		w = io.MultiWriter(&output, lines)
+	}
+
+	if err := b.executor.RunCommandWithOutput(ctx, w, "docker", args...); err != nil {
+		if tail := lastLines(output.String(), logTailLines); tail != "" {
+			return fmt.Errorf("%w\n%s", err, tail)
+		}
+		return err
 	}
 
 	return nil
 }
 
-func (b *Build) pushImage(ctx context.Context, image string) error {
-	_, err := b.executor.RunCommand(ctx, "docker", "push", image)
-	if err != nil {
-		return fmt.Errorf("failed to push image: %w", err)
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
 	}
 
-	return nil
+	return strings.Join(lines, "\n")
+}
+
+// Args returns the arguments to docker that build the image of the service from
+// buildContext, also tagged with tags. The context is "-" when it's streamed on
+// stdin, and the Dockerfile is then looked up inside it. Builds for several
+// platforms or that export their cache need buildx; since buildx can't load an
+// image for several platforms into the local Docker, such an image is pushed by
+// the build itself.
+func Args(service *config.Service, buildContext string, platforms []string, push bool, tags ...string) []string {
+	options := service.Build
+	if options == nil {
+		options = &config.Build{}
+	}
+
+	buildx := len(platforms) > 1 || len(options.CacheTo) > 0
+
+	args := []string{"build"}
+	if buildx {
+		args = []string{"buildx", "build"}
+	}
+	args = append(args, "-t", service.Image)
+	for _, tag := range tags {
+		args = append(args, "-t", Tagged(service.Image, tag))
+	}
+	args = append(args, "--progress", "plain")
+
+	if dockerfile := options.Dockerfile; dockerfile != "" {
+		if buildContext != "-" && !filepath.IsAbs(dockerfile) {
+			dockerfile = filepath.Join(buildContext, dockerfile)
+		}
+		args = append(args, "-f", dockerfile)
+	}
+
+	if len(platforms) > 0 {
+		args = append(args, "--platform", strings.Join(platforms, ","))
+	}
+
+	if options.Target != "" {
+		args = append(args, "--target", options.Target)
+	}
+
+	keys := make([]string, 0, len(options.Args))
+	for key := range options.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--build-arg", key+"="+options.Args[key])
+	}
+
+	for _, secret := range options.Secrets {
+		if secret.Env != "" {
+			args = append(args, "--secret", "id="+secret.ID+",env="+secret.Env)
+		} else {
+			args = append(args, "--secret", "id="+secret.ID+",src="+secret.Src)
+		}
+	}
+
+	for _, cache := range options.CacheFrom {
+		args = append(args, "--cache-from", cache)
+	}
+
+	for _, cache := range options.CacheTo {
+		args = append(args, "--cache-to", cache)
+	}
+
+	if buildx {
+		if len(platforms) > 1 && push {
+			args = append(args, "--push")
+		} else {
+			args = append(args, "--load")
+		}
+	}
+
+	return append(args, buildContext)
+}
+
+// Platform returns the Docker platform of a Linux machine from its hardware name,
+// as printed by uname -m.
+func Platform(machine string) (string, error) {
+	switch machine = strings.TrimSpace(machine); machine {
+	case "x86_64", "amd64":
+		return "linux/amd64", nil
+	case "aarch64", "arm64":
+		return "linux/arm64", nil
+	case "armv7l", "armv7":
+		return "linux/arm/v7", nil
+	case "armv6l", "armv6":
+		return "linux/arm/v6", nil
+	case "i386", "i686":
+		return "linux/386", nil
+	case "ppc64le", "s390x", "riscv64":
+		return "linux/" + machine, nil
+	}
+
+	return "", fmt.Errorf("unsupported machine architecture %q", machine)
 }
@@ -0,0 +1,201 @@
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestArgs(t *testing.T) {
+	service := &config.Service{
+		Name:  "web",
+		Image: "registry.example.com/web:latest",
+		Path:  "./",
+		Build: &config.Build{
+			Dockerfile: "docker/Dockerfile.prod",
+			Context:    "./app",
+			Args:       map[string]string{"VERSION": "1.2.3", "NODE_ENV": "production"},
+			Target:     "runtime",
+			Secrets: []config.BuildSecret{
+				{ID: "npmrc", Src: "./.npmrc"},
+				{ID: "token", Env: "NPM_TOKEN"},
+			},
+			CacheFrom: []string{"type=registry,ref=registry.example.com/web:cache"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		service   *config.Service
+		context   string
+		platforms []string
+		push      bool
+		expected  []string
+	}{
+		{
+			name:     "defaults",
+			service:  &config.Service{Name: "web", Image: "web:latest", Path: "./"},
+			context:  "./",
+			expected: []string{"build", "-t", "web:latest", "--progress", "plain", "./"},
+		},
+		{
+			name:      "single platform",
+			service:   service,
+			context:   "app",
+			platforms: []string{"linux/arm64"},
+			push:      true,
+			expected: []string{
+				"build", "-t", "registry.example.com/web:latest", "--progress", "plain",
+				"-f", "app/docker/Dockerfile.prod",
+				"--platform", "linux/arm64",
+				"--target", "runtime",
+				"--build-arg", "NODE_ENV=production",
+				"--build-arg", "VERSION=1.2.3",
+				"--secret", "id=npmrc,src=./.npmrc",
+				"--secret", "id=token,env=NPM_TOKEN",
+				"--cache-from", "type=registry,ref=registry.example.com/web:cache",
+				"app",
+			},
+		},
+		{
+			name: "several platforms",
+			service: &config.Service{Name: "web", Image: "web:latest", Build: &config.Build{
+				CacheTo: []string{"type=inline"},
+			}},
+			context:   "./",
+			platforms: []string{"linux/amd64", "linux/arm64"},
+			push:      true,
+			expected: []string{
+				"buildx", "build", "-t", "web:latest", "--progress", "plain",
+				"--platform", "linux/amd64,linux/arm64",
+				"--cache-to", "type=inline",
+				"--push", "./",
+			},
+		},
+		{
+			name: "cache export without push",
+			service: &config.Service{Name: "web", Image: "web:latest", Build: &config.Build{
+				CacheTo: []string{"type=local,dest=/tmp/cache"},
+			}},
+			context:   "./",
+			platforms: []string{"linux/amd64"},
+			expected: []string{
+				"buildx", "build", "-t", "web:latest", "--progress", "plain",
+				"--platform", "linux/amd64",
+				"--cache-to", "type=local,dest=/tmp/cache",
+				"--load", "./",
+			},
+		},
+		{
+			name: "context on stdin",
+			service: &config.Service{Name: "web", Image: "web:latest", Build: &config.Build{
+				Mode:       config.BuildRemote,
+				Dockerfile: "Dockerfile.prod",
+			}},
+			context:  "-",
+			expected: []string{"build", "-t", "web:latest", "--progress", "plain", "-f", "Dockerfile.prod", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Args(tt.service, tt.context, tt.platforms, tt.push))
+		})
+	}
+}
+
+func TestPlatform(t *testing.T) {
+	tests := map[string]string{
+		"x86_64\n": "linux/amd64",
+		"aarch64":  "linux/arm64",
+		"armv7l":   "linux/arm/v7",
+		"armv6l":   "linux/arm/v6",
+		"riscv64":  "linux/riscv64",
+	}
+	for machine, expected := range tests {
+		platform, err := Platform(machine)
+		require.NoError(t, err)
+		assert.Equal(t, expected, platform)
+	}
+
+	_, err := Platform("sparc64")
+	assert.Error(t, err)
+}
+
+// fakeExecutor writes output for every command and fails those starting with fail.
+type fakeExecutor struct {
+	output   string
+	fail     string
+	commands []string
+}
+
+func (e *fakeExecutor) RunCommand(context.Context, string, ...string) (io.Reader, error) {
+	return strings.NewReader(""), nil
+}
+
+func (e *fakeExecutor) RunCommandWithOutput(_ context.Context, out io.Writer, command string, args ...string) error {
+	line := strings.Join(append([]string{command}, args...), " ")
+	e.commands = append(e.commands, line)
+	_, _ = io.WriteString(out, e.output)
+	if e.fail != "" && strings.HasPrefix(line, e.fail) {
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func (e *fakeExecutor) RunCommandWithProgress(context.Context, string, string, []string) error {
+	return nil
+}
+
+func TestBuild(t *testing.T) {
+	service := &config.Service{Name: "web", Image: "web:latest", Path: "./"}
+
+	executor := &fakeExecutor{}
+	require.NoError(t, NewBuild(executor).Build(context.Background(), service, []string{"linux/amd64"}, true))
+	assert.Equal(t, []string{
+		"docker build -t web:latest --progress plain --platform linux/amd64 ./",
+		"docker push web:latest",
+	}, executor.commands)
+
+	executor = &fakeExecutor{}
+	require.NoError(t, NewBuild(executor).Build(context.Background(), service, []string{"linux/amd64", "linux/arm64"}, true))
+	assert.Len(t, executor.commands, 1, "a multi-platform image is pushed by the build")
+
+	err := NewBuild(&fakeExecutor{}).Build(context.Background(), service, []string{"linux/amd64", "linux/arm64"}, false)
+	assert.Error(t, err)
+
+	executor = &fakeExecutor{}
+	builder := NewBuild(executor)
+	builder.Tags = []string{"0f3c2a1b9e4d", "1.2.3"}
+	require.NoError(t, builder.Build(context.Background(), service, nil, true))
+	assert.Equal(t, []string{
+		"docker build -t web:latest -t web:0f3c2a1b9e4d -t web:1.2.3 --progress plain ./",
+		"docker push web:latest",
+		"docker push web:0f3c2a1b9e4d",
+		"docker push web:1.2.3",
+	}, executor.commands)
+}
+
+func TestBuild_FailureOutput(t *testing.T) {
+	var output strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&output, "#%d step %d\n", i, i)
+	}
+	output.WriteString("ERROR: failed to solve: process \"/bin/sh -c make\" did not complete successfully\n")
+
+	executor := &fakeExecutor{output: output.String(), fail: "docker build"}
+	err := NewBuild(executor).Build(context.Background(), &config.Service{Name: "web", Image: "web:latest", Path: "./"}, nil, false)
+	require.Error(t, err)
+
+	assert.Contains(t, err.Error(), "build failed: exit status 1\n#12 step 12\n")
+	assert.NotContains(t, err.Error(), "#11 step 11")
+	assert.True(t, strings.HasSuffix(err.Error(), "did not complete successfully"), err.Error())
+}
@@ -0,0 +1,217 @@
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+)
+
+// Context returns the build context in dir as a gzipped tar, the way docker build
+// reads it from stdin. Files matched by .dockerignore are left out, except the
+// Dockerfile and .dockerignore themselves, which the builder always needs.
+func Context(dir string) (io.ReadCloser, error) {
+	ignore, err := readDockerignore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeContext(pw, dir, ignore))
+	}()
+
+	return pr, nil
+}
+
+func writeContext(w io.Writer, dir string, ignore *patternmatcher.PatternMatcher) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "Dockerfile" && rel != ".dockerignore" {
+			skip, err := ignore.MatchesOrParentMatches(rel)
+			if err != nil {
+				return fmt.Errorf("failed to match %s against .dockerignore: %w", rel, err)
+			}
+			if skip {
+				if info.IsDir() && !hasExceptionsIn(ignore, rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive build context: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+func readDockerignore(dir string) (*patternmatcher.PatternMatcher, error) {
+	var patterns []string
+
+	file, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+	default:
+		defer file.Close()
+		if patterns, err = ignorefile.ReadAll(file); err != nil {
+			return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+		}
+	}
+
+	ignore, err := patternmatcher.New(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .dockerignore: %w", err)
+	}
+
+	return ignore, nil
+}
+
+// hasExceptionsIn reports whether an exception pattern may bring back files in
+// the ignored directory, in which case it has to be walked. Docker decides the
+// same way when it sends a build context.
+func hasExceptionsIn(ignore *patternmatcher.PatternMatcher, dir string) bool {
+	if !ignore.Exclusions() {
+		return false
+	}
+
+	prefix := dir + "/"
+	for _, pattern := range ignore.Patterns() {
+		if pattern.Exclusion() && strings.HasPrefix(filepath.ToSlash(pattern.String())+"/", prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Save returns the image from the local Docker as a gzipped tar, the way docker
+// load reads it. Closing the reader waits for docker save and returns its error;
+// docker save is stopped first when the archive wasn't read to the end.
+func Save(ctx context.Context, image string) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, "docker", "save", image)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start docker save: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	archive := &imageArchive{PipeReader: pr, done: make(chan error, 1)}
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, copyErr := io.Copy(gz, stdout)
+		if closeErr := gz.Close(); copyErr == nil {
+			copyErr = closeErr
+		}
+
+		// Once the reader is closed nothing drains the output, and docker save
+		// would block on it forever.
+		if copyErr != nil {
+			_ = cmd.Process.Kill()
+		}
+
+		var err error
+		if waitErr := cmd.Wait(); waitErr != nil && copyErr == nil {
+			err = fmt.Errorf("docker save failed: %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+		}
+		if copyErr != nil && copyErr != io.ErrClosedPipe {
+			err = copyErr
+		}
+
+		pw.CloseWithError(err)
+		archive.done <- err
+	}()
+
+	return archive, nil
+}
+
+// imageArchive is the output of docker save that Save returns.
+type imageArchive struct {
+	*io.PipeReader
+	done chan error
+
+	once sync.Once
+	err  error
+}
+
+func (a *imageArchive) Close() error {
+	a.once.Do(func() {
+		_ = a.PipeReader.Close()
+		a.err = <-a.done
+	})
+
+	return a.err
+}
+
+// ImageID returns the ID of the image in the local Docker.
+func ImageID(ctx context.Context, image string) (string, error) {
+	output, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("image %s not found locally; run 'ftl build' first: %w", image, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
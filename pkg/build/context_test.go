@@ -0,0 +1,102 @@
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":              "FROM alpine:3\n",
+		".dockerignore":           "# local files\nnode_modules\n*.log\n!keep.log\n**/tmp\n/docs\n!docs/api\n",
+		"main.go":                 "package main\n",
+		"debug.log":               "ignored",
+		"keep.log":                "kept",
+		"node_modules/pkg/a.js":   "ignored",
+		"src/app.go":              "package src\n",
+		"src/tmp/cache":           "ignored",
+		"src/nested/tmp/cache":    "ignored",
+		"src/nested/template.txt": "kept",
+		"docs/guide.md":           "ignored",
+		"docs/api/openapi.yaml":   "kept",
+		"src/docs/readme.md":      "kept",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	archive, err := Context(dir)
+	require.NoError(t, err)
+	defer archive.Close()
+
+	gz, err := gzip.NewReader(archive)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+		}
+	}
+	sort.Strings(names)
+
+	assert.Equal(t, []string{
+		".dockerignore",
+		"Dockerfile",
+		"docs/api/openapi.yaml",
+		"keep.log",
+		"main.go",
+		"src/app.go",
+		"src/docs/readme.md",
+		"src/nested/template.txt",
+	}, names)
+}
+
+// fakeDocker puts a docker executable that runs script first on the PATH.
+func fakeDocker(t *testing.T, script string) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\n"+script+"\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSave(t *testing.T) {
+	t.Run("closed early", func(t *testing.T) {
+		fakeDocker(t, "exec yes")
+
+		archive, err := Save(context.Background(), "app:latest")
+		require.NoError(t, err)
+
+		_, err = io.ReadFull(archive, make([]byte, 64))
+		require.NoError(t, err)
+		assert.NoError(t, archive.Close())
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		fakeDocker(t, "echo 'no such image' >&2; exit 1")
+
+		archive, err := Save(context.Background(), "app:latest")
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(archive)
+		assert.ErrorContains(t, err, "no such image")
+		assert.ErrorContains(t, archive.Close(), "docker save failed")
+	})
+}
@@ -0,0 +1,137 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// semverTagRegex matches release tags like v1.2.3 or 1.2.3-rc.1.
+var semverTagRegex = regexp.MustCompile(`^v?([0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?)$`)
+
+// Revision is the git commit images are built from.
+type Revision struct {
+	// Commit is the abbreviated hash of HEAD.
+	Commit string
+	// Dirty is set when the work tree has uncommitted changes, so the images
+	// may not match the commit.
+	Dirty bool
+	// Version is the semantic version of a tag pointing at HEAD, without the
+	// leading "v", or "" when there's none.
+	Version string
+}
+
+// GitRevision returns the revision checked out in dir, or nil when dir isn't in a
+// git repository.
+func GitRevision(ctx context.Context, dir string) (*Revision, error) {
+	commit, err := git(ctx, dir, "rev-parse", "--short=12", "HEAD")
+	if err != nil {
+		return nil, nil
+	}
+
+	status, err := git(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git status: %w", err)
+	}
+
+	revision := &Revision{Commit: commit, Dirty: status != ""}
+
+	tags, err := git(ctx, dir, "tag", "--points-at", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git tags: %w", err)
+	}
+	for _, tag := range strings.Fields(tags) {
+		if match := semverTagRegex.FindStringSubmatch(tag); match != nil {
+			revision.Version = match[1]
+			break
+		}
+	}
+
+	return revision, nil
+}
+
+// String returns the commit with a "-dirty" suffix when the work tree had changes.
+func (r *Revision) String() string {
+	if r.Dirty {
+		return r.Commit + "-dirty"
+	}
+
+	return r.Commit
+}
+
+// Tags returns the image tags for the revision: the commit, and the version when
+// a release tag points at a clean work tree.
+func (r *Revision) Tags() []string {
+	tags := []string{r.String()}
+	if r.Version != "" && !r.Dirty {
+		tags = append(tags, r.Version)
+	}
+
+	return tags
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Repository returns the image reference without its tag and digest.
+func Repository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// A colon after the last slash starts the tag; one before it belongs to the
+	// registry port.
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return image
+}
+
+// Tagged returns the image reference with its tag replaced by tag.
+func Tagged(image, tag string) string {
+	return Repository(image) + ":" + tag
+}
+
+// Pinned returns the image reference fixed to digest.
+func Pinned(image, digest string) string {
+	return Repository(image) + "@" + digest
+}
+
+// IsPinned reports whether the image reference names a digest.
+func IsPinned(image string) bool {
+	return strings.Contains(image, "@")
+}
+
+// Digest returns the digest of the image in its registry. For an image built for
+// several platforms it's the digest of the index, from which every server pulls
+// its own platform.
+func Digest(ctx context.Context, image string) (string, error) {
+	output, err := exec.CommandContext(ctx, "docker", "buildx", "imagetools", "inspect", "--format", "{{json .Manifest}}", image).Output()
+	if err != nil {
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return "", fmt.Errorf("failed to resolve the digest of %s: %w: %s", image, err, stderr)
+	}
+
+	var manifest struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal(output, &manifest); err != nil || manifest.Digest == "" {
+		return "", fmt.Errorf("failed to resolve the digest of %s: unexpected output %q", image, strings.TrimSpace(string(output)))
+	}
+
+	return manifest.Digest, nil
+}
@@ -0,0 +1,77 @@
+package build
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	revision, err := GitRevision(ctx, dir)
+	require.NoError(t, err)
+	assert.Nil(t, revision, "not a git repository")
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=ftl", "GIT_AUTHOR_EMAIL=ftl@example.com",
+			"GIT_COMMITTER_NAME=ftl", "GIT_COMMITTER_EMAIL=ftl@example.com")
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+
+	run("init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:3\n"), 0o644))
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	run("tag", "v1.2.3")
+
+	revision, err = GitRevision(ctx, dir)
+	require.NoError(t, err)
+	require.NotNil(t, revision)
+	assert.Len(t, revision.Commit, 12)
+	assert.False(t, revision.Dirty)
+	assert.Equal(t, "1.2.3", revision.Version)
+	assert.Equal(t, []string{revision.Commit, "1.2.3"}, revision.Tags())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:3.20\n"), 0o644))
+
+	revision, err = GitRevision(ctx, dir)
+	require.NoError(t, err)
+	assert.True(t, revision.Dirty)
+	assert.Equal(t, []string{revision.Commit + "-dirty"}, revision.Tags(), "a dirty tree isn't tagged with the version")
+}
+
+func TestImageReferences(t *testing.T) {
+	tests := []struct {
+		image      string
+		repository string
+	}{
+		{"my-app", "my-app"},
+		{"my-app:latest", "my-app"},
+		{"registry.example.com:5000/team/my-app:1.0", "registry.example.com:5000/team/my-app"},
+		{"registry.example.com:5000/team/my-app", "registry.example.com:5000/team/my-app"},
+		{"my-app:latest@sha256:abc", "my-app"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.repository, Repository(tt.image), tt.image)
+	}
+
+	assert.Equal(t, "registry.example.com:5000/my-app:0f3c2a1b9e4d", Tagged("registry.example.com:5000/my-app:latest", "0f3c2a1b9e4d"))
+	assert.Equal(t, "my-app@sha256:abc", Pinned("my-app:latest", "sha256:abc"))
+	assert.True(t, IsPinned("my-app@sha256:abc"))
+	assert.False(t, IsPinned("my-app:latest"))
+}
@@ -0,0 +1,158 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Issuer obtains certificates from an ACME server using DNS-01 challenges.
+type Issuer struct {
+	DirectoryURL string
+	// AccountKey identifies the ACME account. It should be kept between issuances,
+	// as ACME servers limit how many accounts can be registered; a throwaway key is
+	// generated when it's nil.
+	AccountKey      crypto.Signer
+	Email           string
+	Provider        DNSProvider
+	PropagationWait time.Duration
+}
+
+// Issue orders a certificate for the given domains and returns the PEM encoded
+// chain and private key.
+func (i *Issuer) Issue(ctx context.Context, domains []string) ([]byte, []byte, error) {
+	accountKey := i.AccountKey
+	if accountKey == nil {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate account key: %w", err)
+		}
+		accountKey = key
+	}
+
+	client := &acme.Client{Key: accountKey, DirectoryURL: i.DirectoryURL}
+
+	account := &acme.Account{}
+	if i.Email != "" {
+		account.Contact = []string{"mailto:" + i.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	var cleanups []func()
+	defer func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}()
+
+	for _, authzURL := range order.AuthzURLs {
+		cleanup, err := i.authorize(ctx, client, authzURL)
+		if cleanup != nil {
+			cleanups = append(cleanups, cleanup)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("order failed: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: domains}, certKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to finalize order: %w", err)
+	}
+
+	var certPEM bytes.Buffer
+	for _, der := range chain {
+		if err := pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode certificate: %w", err)
+		}
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM.Bytes(), keyPEM, nil
+}
+
+func (i *Issuer) authorize(ctx context.Context, client *acme.Client, authzURL string) (func(), error) {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization: %w", err)
+	}
+
+	if authz.Status == acme.StatusValid {
+		return nil, nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return nil, fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute challenge record: %w", err)
+	}
+
+	fqdn := "_acme-challenge." + authz.Identifier.Value
+	if err := i.Provider.Present(ctx, fqdn, value); err != nil {
+		return nil, fmt.Errorf("failed to publish challenge record for %s: %w", fqdn, err)
+	}
+	cleanup := func() { _ = i.Provider.CleanUp(context.Background(), fqdn, value) }
+
+	select {
+	case <-ctx.Done():
+		return cleanup, ctx.Err()
+	case <-time.After(i.PropagationWait):
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return cleanup, fmt.Errorf("failed to accept challenge: %w", err)
+	}
+
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return cleanup, fmt.Errorf("authorization for %s failed: %w", authz.Identifier.Value, err)
+	}
+
+	return cleanup, nil
+}
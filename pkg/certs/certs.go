@@ -0,0 +1,245 @@
+package certs
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+const (
+	renewBefore        = 30 * 24 * time.Hour
+	letsEncryptURL     = "https://acme-v02.api.letsencrypt.org/directory"
+	defaultPropagation = 30 * time.Second
+)
+
+// Domains returns the names the project certificate has to cover.
+func Domains(cfg *config.Config) []string {
+	domains := []string{cfg.Project.Domain}
+	if cfg.TLS.DNS != nil && cfg.TLS.DNS.Wildcard {
+		domains = append(domains, "*."+cfg.Project.Domain)
+	}
+
+	return domains
+}
+
+// Obtain returns the PEM encoded certificate chain and private key for the project.
+// Custom certificates are loaded as configured. DNS-01 certificates are issued once
+// and cached under ~/.ftl/certs, so every server gets the same pair and renewal only
+// happens when the cached certificate gets close to expiry.
+func Obtain(ctx context.Context, cfg *config.Config) ([]byte, []byte, error) {
+	switch cfg.TLS.Mode {
+	case "custom":
+		certificate, err := fromEnv(cfg.TLS.Certificate, cfg.TLS.CertificateEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := fromEnv(cfg.TLS.Key, cfg.TLS.KeyEnv)
+		if err != nil {
+			return nil, nil, err
+		}
+		return LoadPair(certificate, key)
+	case "dns":
+		return obtainDNS(ctx, cfg)
+	default:
+		return nil, nil, fmt.Errorf("certificates for TLS mode %q are managed by the proxy", cfg.TLS.Mode)
+	}
+}
+
+// LoadPair reads a certificate and key, each given either as a file path or as
+// inline PEM, and checks that they match.
+func LoadPair(certificate, key string) ([]byte, []byte, error) {
+	certPEM, err := readPEM(certificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	keyPEM, err := readPEM(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate and key pair: %w", err)
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// NeedsRenewal reports whether the certificate is missing, unparsable, doesn't
+// cover all domains or expires within the given window.
+func NeedsRenewal(certPEM []byte, domains []string, within time.Duration) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return true
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+
+	for _, domain := range domains {
+		if cert.VerifyHostname(strings.Replace(domain, "*", "ftl-wildcard-check", 1)) != nil {
+			return true
+		}
+	}
+
+	return time.Now().Add(within).After(cert.NotAfter)
+}
+
+// fromEnv returns the value of the environment variable env when it's set in the
+// config, and value otherwise.
+func fromEnv(value, env string) (string, error) {
+	if env == "" {
+		return value, nil
+	}
+
+	value = os.Getenv(env)
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", env)
+	}
+
+	return value, nil
+}
+
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(strings.TrimSpace(value) + "\n"), nil
+	}
+
+	path, err := expandHome(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+func obtainDNS(ctx context.Context, cfg *config.Config) ([]byte, []byte, error) {
+	domains := Domains(cfg)
+
+	cacheDir, err := cacheDir(cfg.Project.Domain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPath := filepath.Join(cacheDir, "cert.pem")
+	keyPath := filepath.Join(cacheDir, "key.pem")
+
+	if certPEM, keyPEM, err := LoadPair(certPath, keyPath); err == nil && !NeedsRenewal(certPEM, domains, renewBefore) {
+		return certPEM, keyPEM, nil
+	}
+
+	provider, err := NewDNSProvider(cfg.TLS.DNS.Provider, cfg.TLS.DNS.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accountKey, err := loadAccountKey(filepath.Join(filepath.Dir(cacheDir), "account.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issuer := &Issuer{
+		DirectoryURL:    cfg.TLS.DNS.Directory,
+		AccountKey:      accountKey,
+		Email:           cfg.Project.Email,
+		Provider:        provider,
+		PropagationWait: cfg.TLS.DNS.PropagationWait,
+	}
+	if issuer.DirectoryURL == "" {
+		issuer.DirectoryURL = letsEncryptURL
+	}
+	if issuer.PropagationWait == 0 {
+		issuer.PropagationWait = defaultPropagation
+	}
+
+	certPEM, keyPEM, err := issuer.Issue(ctx, domains)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate cache: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to cache certificate: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to cache key: %w", err)
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// loadAccountKey reads the ACME account key cached at path, creating it on first
+// use. The same key is used for every domain and ACME server.
+func loadAccountKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid ACME account key in %s", path)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ACME account key in %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read ACME account key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode account key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create certificate cache: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to cache ACME account key: %w", err)
+	}
+
+	return key, nil
+}
+
+func cacheDir(domain string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".ftl", "certs", domain), nil
+}
+
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(home, path[2:]), nil
+}
@@ -0,0 +1,205 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+type CertsTestSuite struct {
+	suite.Suite
+}
+
+func TestCertsSuite(t *testing.T) {
+	suite.Run(t, new(CertsTestSuite))
+}
+
+func selfSigned(t *testing.T, notAfter time.Time, domains ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (suite *CertsTestSuite) TestLoadPair() {
+	certPEM, keyPEM := selfSigned(suite.T(), time.Now().Add(90*24*time.Hour), "example.com")
+
+	suite.Run("inline PEM", func() {
+		loadedCert, loadedKey, err := LoadPair(string(certPEM), string(keyPEM))
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), certPEM, loadedCert)
+		assert.Equal(suite.T(), keyPEM, loadedKey)
+	})
+
+	suite.Run("files", func() {
+		dir := suite.T().TempDir()
+		certPath := filepath.Join(dir, "cert.pem")
+		keyPath := filepath.Join(dir, "key.pem")
+		assert.NoError(suite.T(), os.WriteFile(certPath, certPEM, 0600))
+		assert.NoError(suite.T(), os.WriteFile(keyPath, keyPEM, 0600))
+
+		loadedCert, loadedKey, err := LoadPair(certPath, keyPath)
+
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), certPEM, loadedCert)
+		assert.Equal(suite.T(), keyPEM, loadedKey)
+	})
+
+	suite.Run("mismatched key", func() {
+		_, otherKey := selfSigned(suite.T(), time.Now().Add(time.Hour), "example.com")
+
+		_, _, err := LoadPair(string(certPEM), string(otherKey))
+
+		assert.Error(suite.T(), err)
+		assert.Contains(suite.T(), err.Error(), "invalid certificate and key pair")
+	})
+}
+
+func (suite *CertsTestSuite) TestObtainCustomFromEnv() {
+	certPEM, keyPEM := selfSigned(suite.T(), time.Now().Add(90*24*time.Hour), "example.com")
+	suite.T().Setenv("TLS_CERTIFICATE", string(certPEM))
+	suite.T().Setenv("TLS_KEY", string(keyPEM))
+
+	cfg, err := config.ParseConfig([]byte(`
+project:
+  name: "test-project"
+  domain: "example.com"
+  email: "test@example.com"
+servers:
+  - host: "example.com"
+    port: 22
+    user: "deploy"
+    ssh_key: "~/.ssh/id_rsa"
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+dependencies: []
+tls:
+  mode: custom
+  certificate_env: TLS_CERTIFICATE
+  key_env: TLS_KEY
+`))
+	suite.Require().NoError(err)
+
+	loadedCert, loadedKey, err := Obtain(context.Background(), cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), certPEM, loadedCert)
+	assert.Equal(suite.T(), keyPEM, loadedKey)
+
+	suite.T().Setenv("TLS_KEY", "")
+	_, _, err = Obtain(context.Background(), cfg)
+	assert.ErrorContains(suite.T(), err, "environment variable TLS_KEY is not set")
+}
+
+func (suite *CertsTestSuite) TestLoadAccountKey() {
+	path := filepath.Join(suite.T().TempDir(), "certs", "account.pem")
+
+	created, err := loadAccountKey(path)
+	suite.Require().NoError(err)
+
+	info, err := os.Stat(path)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := loadAccountKey(path)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), created.(*ecdsa.PrivateKey).Equal(loaded))
+}
+
+func (suite *CertsTestSuite) TestNeedsRenewal() {
+	valid, _ := selfSigned(suite.T(), time.Now().Add(90*24*time.Hour), "example.com", "*.example.com")
+	expiring, _ := selfSigned(suite.T(), time.Now().Add(24*time.Hour), "example.com")
+
+	assert.False(suite.T(), NeedsRenewal(valid, []string{"example.com", "*.example.com"}, renewBefore))
+	assert.True(suite.T(), NeedsRenewal(expiring, []string{"example.com"}, renewBefore))
+	assert.True(suite.T(), NeedsRenewal(expiring, []string{"*.example.com"}, time.Minute))
+	assert.True(suite.T(), NeedsRenewal([]byte("garbage"), []string{"example.com"}, renewBefore))
+}
+
+func (suite *CertsTestSuite) TestDomains() {
+	cfg := &config.Config{Project: config.Project{Domain: "example.com"}}
+	assert.Equal(suite.T(), []string{"example.com"}, Domains(cfg))
+
+	cfg.TLS.DNS = &config.DNSChallenge{Provider: "file", Wildcard: true}
+	assert.Equal(suite.T(), []string{"example.com", "*.example.com"}, Domains(cfg))
+}
+
+func (suite *CertsTestSuite) TestFileProvider() {
+	path := filepath.Join(suite.T().TempDir(), "records.zone")
+
+	provider, err := NewDNSProvider("file", map[string]string{"path": path})
+	assert.NoError(suite.T(), err)
+
+	ctx := context.Background()
+	assert.NoError(suite.T(), provider.Present(ctx, "_acme-challenge.example.com", "first"))
+	assert.NoError(suite.T(), provider.Present(ctx, "_acme-challenge.example.com", "second"))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "_acme-challenge.example.com. 60 IN TXT \"first\"\n_acme-challenge.example.com. 60 IN TXT \"second\"\n", string(data))
+
+	assert.NoError(suite.T(), provider.CleanUp(ctx, "_acme-challenge.example.com", "first"))
+
+	data, err = os.ReadFile(path)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "_acme-challenge.example.com. 60 IN TXT \"second\"\n", string(data))
+}
+
+func (suite *CertsTestSuite) TestHookProvider() {
+	path := filepath.Join(suite.T().TempDir(), "hook.log")
+
+	provider, err := NewDNSProvider("hook", map[string]string{
+		"present": `echo "present $FTL_DNS_FQDN $FTL_DNS_VALUE" >> ` + path,
+		"cleanup": `echo "cleanup $FTL_DNS_FQDN $FTL_DNS_VALUE" >> ` + path,
+	})
+	assert.NoError(suite.T(), err)
+
+	ctx := context.Background()
+	assert.NoError(suite.T(), provider.Present(ctx, "_acme-challenge.example.com", "token"))
+	assert.NoError(suite.T(), provider.CleanUp(ctx, "_acme-challenge.example.com", "token"))
+
+	data, err := os.ReadFile(path)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "present _acme-challenge.example.com token\ncleanup _acme-challenge.example.com token\n", string(data))
+}
+
+func (suite *CertsTestSuite) TestNewDNSProvider_Unknown() {
+	_, err := NewDNSProvider("carrier-pigeon", nil)
+
+	assert.Error(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), "unknown DNS provider")
+}
@@ -0,0 +1,151 @@
+package certs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// DNSProvider publishes and removes the TXT records used by ACME DNS-01 challenges.
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// DNSProviderFactory builds a DNSProvider from the options given in ftl.yaml.
+type DNSProviderFactory func(options map[string]string) (DNSProvider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]DNSProviderFactory{
+		"hook": newHookProvider,
+		"file": newFileProvider,
+	}
+)
+
+// RegisterDNSProvider makes a DNS provider available under the given name.
+func RegisterDNSProvider(name string, factory DNSProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[name] = factory
+}
+
+// NewDNSProvider creates the DNS provider registered under the given name.
+func NewDNSProvider(name string, options map[string]string) (DNSProvider, error) {
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q", name)
+	}
+
+	return factory(options)
+}
+
+// HookProvider runs local shell commands to manage challenge records. The record
+// name and value are passed in the FTL_DNS_FQDN and FTL_DNS_VALUE environment variables.
+type HookProvider struct {
+	present string
+	cleanup string
+}
+
+func newHookProvider(options map[string]string) (DNSProvider, error) {
+	if options["present"] == "" {
+		return nil, fmt.Errorf("hook DNS provider requires the present option")
+	}
+
+	return &HookProvider{present: options["present"], cleanup: options["cleanup"]}, nil
+}
+
+func (p *HookProvider) Present(ctx context.Context, fqdn, value string) error {
+	return runHook(ctx, p.present, fqdn, value)
+}
+
+func (p *HookProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	if p.cleanup == "" {
+		return nil
+	}
+
+	return runHook(ctx, p.cleanup, fqdn, value)
+}
+
+func runHook(ctx context.Context, command, fqdn, value string) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "FTL_DNS_FQDN="+fqdn, "FTL_DNS_VALUE="+value)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("DNS hook failed: %w\n%s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// FileProvider writes challenge records as zone file lines to a local file, for
+// setups where the zone is published from a file or a record has to be added by hand.
+type FileProvider struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newFileProvider(options map[string]string) (DNSProvider, error) {
+	if options["path"] == "" {
+		return nil, fmt.Errorf("file DNS provider requires the path option")
+	}
+
+	path, err := expandHome(options["path"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileProvider{path: path}, nil
+}
+
+func (p *FileProvider) Present(_ context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open record file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(record(fqdn, value) + "\n")
+	return err
+}
+
+func (p *FileProvider) CleanUp(_ context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := os.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read record file: %w", err)
+	}
+
+	var kept []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line != "" && line != record(fqdn, value) {
+			kept = append(kept, line)
+		}
+	}
+
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+
+	return os.WriteFile(p.path, []byte(content), 0644)
+}
+
+func record(fqdn, value string) string {
+	return fmt.Sprintf("%s. 60 IN TXT %q", strings.TrimSuffix(fqdn, "."), value)
+}
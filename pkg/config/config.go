@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -17,12 +18,20 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// SchedulerName is the name of the container that runs the jobs on every server.
+const SchedulerName = "scheduler"
+
 type Config struct {
 	Project      Project      `yaml:"project" validate:"required"`
+	Proxy        Proxy        `yaml:"proxy"`
+	TLS          TLS          `yaml:"tls"`
 	Servers      []Server     `yaml:"servers" validate:"required,dive"`
 	Services     []Service    `yaml:"services" validate:"required,dive"`
 	Dependencies []Dependency `yaml:"dependencies" validate:"required,dive"`
-	Volumes      []string     `yaml:"volumes" validate:"dive"`
+	Static       []Static     `yaml:"static" validate:"dive"`
+	Jobs         []Job        `yaml:"jobs" validate:"dive"`
+	Volumes      []Volume     `yaml:"volumes" validate:"dive"`
+	Backups      []Backup     `yaml:"backups" validate:"dive"`
 }
 
 type Project struct {
@@ -31,6 +40,67 @@ type Project struct {
 	Email  string `yaml:"email" validate:"required,email"`
 }
 
+type Proxy struct {
+	Type        string            `yaml:"type" validate:"oneof=nginx caddy"`
+	Enabled     *bool             `yaml:"enabled"`
+	Image       string            `yaml:"image"`
+	HTTPPort    int               `yaml:"http_port" validate:"omitempty,min=1,max=65535"`
+	HTTPSPort   int               `yaml:"https_port" validate:"omitempty,min=1,max=65535,nefield=HTTPPort"`
+	BindAddress string            `yaml:"bind_address" validate:"omitempty,ip"`
+	Volumes     []Mount           `yaml:"volumes" validate:"dive"`
+	EnvVars     map[string]string `yaml:"env"`
+	Memory      string            `yaml:"memory" validate:"omitempty,memory_size"`
+	CPUs        string            `yaml:"cpus" validate:"omitempty,numeric"`
+	HealthCheck *HealthCheck      `yaml:"health_check"`
+	Snippet     string            `yaml:"snippet" validate:"omitempty,nginx_snippet"`
+}
+
+// IsEnabled reports whether FTL manages a proxy in front of the services.
+// The proxy can be turned off for hosts that sit behind an external load balancer.
+func (p *Proxy) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// Ports returns the host ports the proxy publishes for HTTP and HTTPS.
+func (p *Proxy) Ports() (int, int) {
+	httpPort, httpsPort := p.HTTPPort, p.HTTPSPort
+	if httpPort == 0 {
+		httpPort = 80
+	}
+	if httpsPort == 0 {
+		httpsPort = 443
+	}
+
+	return httpPort, httpsPort
+}
+
+type TLS struct {
+	Mode string `yaml:"mode" validate:"oneof=acme custom dns"`
+	// Certificate and Key are file paths or inline PEM. CertificateEnv and KeyEnv
+	// name environment variables holding the PEM instead; those are read when the
+	// certificate is loaded, as a multi-line value substituted into the YAML
+	// would break it.
+	Certificate    string        `yaml:"certificate"`
+	CertificateEnv string        `yaml:"certificate_env"`
+	Key            string        `yaml:"key"`
+	KeyEnv         string        `yaml:"key_env"`
+	DNS            *DNSChallenge `yaml:"dns" validate:"required_if=Mode dns"`
+}
+
+// HasOwnCertificate reports whether FTL supplies the certificate to the proxy,
+// rather than the proxy obtaining one over HTTP-01 by itself.
+func (t *TLS) HasOwnCertificate() bool {
+	return t.Mode == "custom" || t.Mode == "dns"
+}
+
+type DNSChallenge struct {
+	Provider        string            `yaml:"provider" validate:"required"`
+	Wildcard        bool              `yaml:"wildcard"`
+	Directory       string            `yaml:"directory" validate:"omitempty,url"`
+	PropagationWait time.Duration     `yaml:"propagation_wait" validate:"min=0"`
+	Options         map[string]string `yaml:"options"`
+}
+
 type Server struct {
 	Host   string `yaml:"host" validate:"required,fqdn|ip"`
 	Port   int    `yaml:"port" validate:"required,min=1,max=65535"`
@@ -41,58 +111,417 @@ type Server struct {
 type Service struct {
 	Name        string       `yaml:"name" validate:"required"`
 	Image       string       `yaml:"image" validate:"required"`
-	Port        int          `yaml:"port" validate:"required,min=1,max=65535"`
+	Kind        string       `yaml:"kind" validate:"oneof=web worker"`
+	Port        int          `yaml:"port" validate:"required_unless=Kind worker,min=0,max=65535"`
 	Path        string       `yaml:"path"`
+	Protocol    string       `yaml:"protocol" validate:"oneof=http tcp udp"`
+	PublicPort  int          `yaml:"public_port" validate:"required_unless=Protocol http,max=65535"`
 	HealthCheck *HealthCheck `yaml:"health_check"`
-	Routes      []Route      `yaml:"routes" validate:"required,dive"`
-	Volumes     []string     `yaml:"volumes" validate:"dive,volume_reference"`
+	Routes      []Route      `yaml:"routes" validate:"required_if=Kind web Protocol http,dive"`
+	Volumes     []Mount      `yaml:"volumes" validate:"dive"`
+	Build       *Build       `yaml:"build"`
+	Runtime     `yaml:",inline"`
 
 	Forwards []string
 
 	EnvVars map[string]string
 }
 
+// Runtime holds the "docker run" options shared by services and dependencies.
+type Runtime struct {
+	Restart    string            `yaml:"restart" validate:"omitempty,restart_policy"`
+	Memory     string            `yaml:"memory" validate:"omitempty,memory_size"`
+	CPUs       string            `yaml:"cpus" validate:"omitempty,numeric"`
+	User       string            `yaml:"user"`
+	Command    []string          `yaml:"command"`
+	Entrypoint []string          `yaml:"entrypoint"`
+	Ulimits    map[string]string `yaml:"ulimits" validate:"dive,keys,ulimit_name,endkeys,ulimit_value"`
+	CapAdd     []string          `yaml:"cap_add" validate:"dive,capability"`
+	CapDrop    []string          `yaml:"cap_drop" validate:"dive,capability"`
+	ReadOnly   bool              `yaml:"read_only"`
+	Tmpfs      []string          `yaml:"tmpfs" validate:"dive,startswith=/"`
+	Labels     map[string]string `yaml:"labels" validate:"dive,keys,label_key,endkeys"`
+	Logging    *Logging          `yaml:"logging"`
+}
+
+// DefaultRestartPolicy is used when a service or dependency doesn't set one, so
+// containers come back after the Docker daemon or the host restarts.
+const DefaultRestartPolicy = "unless-stopped"
+
+type Logging struct {
+	Driver  string            `yaml:"driver" validate:"required"`
+	Options map[string]string `yaml:"options"`
+}
+
+// IsWorker reports whether the service is a background worker, such as a queue
+// consumer, that takes no traffic and so has no port or routes.
+func (s *Service) IsWorker() bool {
+	return s.Kind == "worker"
+}
+
+// IsStream reports whether the service is exposed through the proxy as a raw
+// TCP or UDP stream instead of HTTP routes.
+func (s *Service) IsStream() bool {
+	return s.Protocol == "tcp" || s.Protocol == "udp"
+}
+
+// Build modes of a service image.
+const (
+	// BuildRegistry pushes the image to a registry, from which the servers pull it.
+	BuildRegistry = "registry"
+	// BuildRemote builds the image on every server from the build context.
+	BuildRemote = "remote"
+	// BuildLoad builds the image locally and loads it into every server.
+	BuildLoad = "load"
+)
+
+// Build sets how the image of a service is built and how it gets to the servers.
+// Platforms default to those of the servers.
+type Build struct {
+	Mode       string            `yaml:"mode" validate:"omitempty,oneof=registry remote load"`
+	Dockerfile string            `yaml:"dockerfile"`
+	Context    string            `yaml:"context"`
+	Args       map[string]string `yaml:"args"`
+	Target     string            `yaml:"target"`
+	Platforms  []string          `yaml:"platforms" validate:"dive,platform"`
+	Secrets    []BuildSecret     `yaml:"secrets" validate:"dive"`
+	CacheFrom  []string          `yaml:"cache_from" validate:"dive,required"`
+	CacheTo    []string          `yaml:"cache_to" validate:"dive,required"`
+}
+
+// BuildSecret is passed to the build with --secret, read from a local file or
+// environment variable, so it's available to RUN --mount=type=secret without
+// ending up in the image.
+type BuildSecret struct {
+	ID  string `yaml:"id" validate:"required"`
+	Src string `yaml:"src" validate:"required_without=Env,excluded_with=Env"`
+	Env string `yaml:"env" validate:"omitempty,env_name"`
+}
+
+// BuildContext returns the directory the image of the service is built from.
+func (s *Service) BuildContext() string {
+	if s.Build != nil && s.Build.Context != "" {
+		return s.Build.Context
+	}
+
+	return s.Path
+}
+
+// BuildMode returns how the image of the service gets to the servers; registry
+// unless the service sets another mode.
+func (s *Service) BuildMode() string {
+	if s.Build == nil || s.Build.Mode == "" {
+		return BuildRegistry
+	}
+
+	return s.Build.Mode
+}
+
 type EnvVar struct {
 	Name  string
 	Value string
 }
 
 type HealthCheck struct {
-	Path     string
-	Interval time.Duration
-	Timeout  time.Duration
-	Retries  int
+	Type           string        `yaml:"type" validate:"oneof=http tcp cmd"`
+	Path           string        `yaml:"path" validate:"omitempty,startswith=/"`
+	Port           int           `yaml:"port" validate:"omitempty,min=1,max=65535"`
+	Command        string        `yaml:"command" validate:"required_if=Type cmd"`
+	ExpectedStatus []int         `yaml:"expected_status" validate:"dive,min=100,max=599"`
+	ExpectedBody   string        `yaml:"expected_body"`
+	Interval       time.Duration `yaml:"interval" validate:"min=1ms"`
+	Timeout        time.Duration `yaml:"timeout" validate:"min=1ms"`
+	StartPeriod    time.Duration `yaml:"start_period" validate:"min=0"`
+	Retries        int           `yaml:"retries" validate:"min=1"`
+	Mode           string        `yaml:"mode" validate:"oneof=container sidecar"`
+	Image          string        `yaml:"image"`
+}
+
+// Defaults applied to health check fields that are left out of the config.
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 5 * time.Second
+	DefaultHealthCheckRetries  = 3
+)
+
+// applyDefaults fills in the fields left out of the config, so that a bare
+// health_check section still polls a few times before giving up.
+func (h *HealthCheck) applyDefaults() {
+	if h.Type == "" {
+		h.Type = "http"
+	}
+	if h.Type == "http" && h.Path == "" {
+		h.Path = "/"
+	}
+	if h.Interval == 0 {
+		h.Interval = DefaultHealthCheckInterval
+	}
+	if h.Timeout == 0 {
+		h.Timeout = DefaultHealthCheckTimeout
+	}
+	if h.Retries == 0 {
+		h.Retries = DefaultHealthCheckRetries
+	}
+	if h.Mode == "" {
+		h.Mode = "container"
+	}
+}
+
+// IsSidecar reports whether the check is run by FTL from a throwaway container on
+// the project network rather than by Docker inside the checked container.
+func (h *HealthCheck) IsSidecar() bool {
+	return h.Mode == "sidecar"
 }
 
 type Route struct {
-	PathPrefix  string `yaml:"path" validate:"required"`
-	StripPrefix bool   `yaml:"strip_prefix"`
+	PathPrefix        string            `yaml:"path" validate:"required"`
+	StripPrefix       bool              `yaml:"strip_prefix"`
+	ClientMaxBodySize string            `yaml:"client_max_body_size" validate:"omitempty,nginx_size"`
+	ProxyReadTimeout  string            `yaml:"proxy_read_timeout" validate:"omitempty,nginx_time"`
+	Websocket         bool              `yaml:"websocket"`
+	RequestHeaders    map[string]string `yaml:"request_headers" validate:"dive,keys,header_name,endkeys,header_value"`
+	ResponseHeaders   map[string]string `yaml:"response_headers" validate:"dive,keys,header_name,endkeys,header_value"`
+	BasicAuth         *BasicAuth        `yaml:"basic_auth"`
+	Allow             []string          `yaml:"allow" validate:"dive,ip|cidr|eq=all"`
+	Deny              []string          `yaml:"deny" validate:"dive,ip|cidr|eq=all"`
+	RateLimit         *RateLimit        `yaml:"rate_limit"`
+	Snippet           string            `yaml:"snippet" validate:"omitempty,nginx_snippet"`
+}
+
+type BasicAuth struct {
+	Realm string   `yaml:"realm" validate:"header_value"`
+	Users []string `yaml:"users" validate:"required,min=1,dive,htpasswd_entry"`
+}
+
+type RateLimit struct {
+	Rate    string `yaml:"rate" validate:"required,nginx_rate"`
+	Burst   int    `yaml:"burst" validate:"min=0"`
+	NoDelay bool   `yaml:"nodelay"`
+}
+
+// Static is a directory of files, such as an SPA build, that is uploaded on deploy
+// and served by the proxy directly instead of from a service container.
+type Static struct {
+	Name        string        `yaml:"name" validate:"required,static_name"`
+	Path        string        `yaml:"path" validate:"required"`
+	PathPrefix  string        `yaml:"route" validate:"startswith=/"`
+	SPA         bool          `yaml:"spa"`
+	CacheMaxAge time.Duration `yaml:"cache_max_age" validate:"min=0"`
+	Keep        int           `yaml:"keep" validate:"min=1"`
+}
+
+// Job is a one-off container that the project's scheduler runs on a cron schedule,
+// such as a nightly report or a cleanup task.
+type Job struct {
+	Name     string            `yaml:"name" validate:"required,job_name"`
+	Schedule string            `yaml:"schedule" validate:"required,cron_schedule"`
+	Image    string            `yaml:"image" validate:"required"`
+	Command  []string          `yaml:"command"`
+	EnvVars  map[string]string `yaml:"env" validate:"dive,keys,env_name,endkeys,env_value"`
+	Volumes  []Mount           `yaml:"volumes" validate:"dive"`
+}
+
+// Backup archives a named volume on the server on a cron schedule, keeping the
+// last Keep archives.
+type Backup struct {
+	Volume   string `yaml:"volume" validate:"required"`
+	Schedule string `yaml:"schedule" validate:"required,cron_schedule"`
+	Keep     int    `yaml:"keep" validate:"min=1"`
+}
+
+// JobName is the name of the scheduled job that takes the backup.
+func (b *Backup) JobName() string {
+	return "backup-" + b.Volume
 }
 
 type Dependency struct {
-	Name    string            `yaml:"name" validate:"required"`
-	Image   string            `yaml:"image" validate:"required"`
-	Volumes []string          `yaml:"volumes" validate:"dive,volume_reference"`
-	EnvVars map[string]string `yaml:"env" validate:"dive"`
+	Name        string            `yaml:"name" validate:"required"`
+	Image       string            `yaml:"image" validate:"required"`
+	Volumes     []Mount           `yaml:"volumes" validate:"dive"`
+	EnvVars     map[string]string `yaml:"env" validate:"dive"`
+	HealthCheck *HealthCheck      `yaml:"health_check"`
+	Runtime     `yaml:",inline"`
+
+	// PreRecreate is a shell command run inside the running container before
+	// it's replaced with --recreate-dependency, typically to take a backup.
+	PreRecreate string `yaml:"pre_recreate"`
 }
 
+// Volume is a named volume of the project. It can be written as just its name.
+// The driver and its options only apply when the volume is created.
 type Volume struct {
-	Name string `yaml:"name" validate:"required"`
-	Path string `yaml:"path" validate:"required,unix_path"`
+	Name       string            `yaml:"name" validate:"required,volume_name"`
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+}
+
+func (v *Volume) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&v.Name)
+	}
+
+	type plain Volume
+	return node.Decode((*plain)(v))
+}
+
+// Mount types.
+const (
+	MountVolume = "volume"
+	MountBind   = "bind"
+	MountTmpfs  = "tmpfs"
+)
+
+// Mount is a named volume, a path on the server or a tmpfs mounted into a
+// container. It can be written in the short "source:target[:ro]" form, where a
+// source starting with "/" or "." is a path on the server and anything else a
+// named volume. Relative paths are resolved against the project folder.
+type Mount struct {
+	Type     string `yaml:"type" validate:"oneof=volume bind tmpfs"`
+	Source   string `yaml:"source" validate:"required_unless=Type tmpfs,excluded_if=Type tmpfs,excludesall=0x2C"`
+	Target   string `yaml:"target" validate:"required,startswith=/,excludesall=0x2C"`
+	ReadOnly bool   `yaml:"read_only"`
+	// Size limits a tmpfs, like 64m.
+	Size string `yaml:"size" validate:"omitempty,memory_size"`
+}
+
+// ParseMount parses the short "source:target[:ro|rw]" form of a mount.
+func ParseMount(spec string) (Mount, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 {
+		return Mount{}, fmt.Errorf("invalid volume %q: expected source:target[:ro]", spec)
+	}
+
+	mount := Mount{Source: parts[0]}
+	if len(parts) > 1 {
+		mount.Target = parts[1]
+	}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "ro":
+			mount.ReadOnly = true
+		case "rw":
+		default:
+			return Mount{}, fmt.Errorf("invalid volume %q: mode must be ro or rw", spec)
+		}
+	}
+	mount.Type = mountType(mount.Source)
+
+	return mount, nil
+}
+
+func (m *Mount) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		mount, err := ParseMount(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*m = mount
+		return nil
+	}
+
+	type plain Mount
+	if err := node.Decode((*plain)(m)); err != nil {
+		return err
+	}
+	if m.Type == "" && m.Source != "" {
+		m.Type = mountType(m.Source)
+	}
+
+	return nil
+}
+
+// String returns the mount in its short form, which is also how it's hashed, so
+// that rewriting a volume in the long form doesn't cause a redeploy.
+func (m Mount) String() string {
+	spec := m.Source + ":" + m.Target
+	if m.Type == MountTmpfs {
+		spec = MountTmpfs + ":" + m.Target
+	}
+	if m.ReadOnly {
+		spec += ":ro"
+	}
+	if m.Size != "" {
+		spec += ":size=" + m.Size
+	}
+
+	return spec
+}
+
+func (m Mount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// IsRelative reports whether the mount is a path relative to the project folder.
+func (m *Mount) IsRelative() bool {
+	return m.Type == MountBind && !strings.HasPrefix(m.Source, "/")
+}
+
+func mountType(source string) string {
+	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") {
+		return MountBind
+	}
+
+	return MountVolume
 }
 
 func ParseConfig(data []byte) (*Config, error) {
-	expandedData := os.ExpandEnv(string(data))
+	expandedData := expandEnv(string(data))
 
 	var config Config
 	if err := yaml.Unmarshal([]byte(expandedData), &config); err != nil {
 		return nil, fmt.Errorf("error parsing YAML: %v", err)
 	}
 
+	if config.Proxy.Type == "" {
+		config.Proxy.Type = "nginx"
+	}
+
+	if config.TLS.Mode == "" {
+		config.TLS.Mode = "acme"
+	}
+
+	if config.Proxy.HealthCheck != nil {
+		config.Proxy.HealthCheck.applyDefaults()
+	}
+	for i := range config.Services {
+		if config.Services[i].HealthCheck != nil {
+			config.Services[i].HealthCheck.applyDefaults()
+		}
+	}
+	for i := range config.Dependencies {
+		if config.Dependencies[i].HealthCheck != nil {
+			config.Dependencies[i].HealthCheck.applyDefaults()
+		}
+	}
+
+	for i := range config.Static {
+		if config.Static[i].PathPrefix == "" {
+			config.Static[i].PathPrefix = "/"
+		}
+		if config.Static[i].CacheMaxAge == 0 {
+			config.Static[i].CacheMaxAge = time.Hour
+		}
+		if config.Static[i].Keep == 0 {
+			config.Static[i].Keep = 5
+		}
+	}
+
+	for i := range config.Backups {
+		if config.Backups[i].Keep == 0 {
+			config.Backups[i].Keep = 7
+		}
+	}
+
 	for service := range config.Services {
 		if config.Services[service].Path == "" {
 			config.Services[service].Path = "./"
 		}
+		if config.Services[service].Protocol == "" {
+			config.Services[service].Protocol = "http"
+		}
+		if config.Services[service].Kind == "" {
+			config.Services[service].Kind = "web"
+		}
 		envPath := filepath.Join(config.Services[service].Path, ".env")
 		if _, err := os.Stat(envPath); os.IsNotExist(err) {
 			continue
@@ -112,24 +541,493 @@ func ParseConfig(data []byte) (*Config, error) {
 
 	validate := validator.New()
 
-	_ = validate.RegisterValidation("volume_reference", func(fl validator.FieldLevel) bool {
-		value := fl.Field().String()
-		parts := strings.Split(value, ":")
-		return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+	_ = validate.RegisterValidation("volume_name", func(fl validator.FieldLevel) bool {
+		return volumeNameRegex.MatchString(fl.Field().String())
 	})
 
-	_ = validate.RegisterValidation("unix_path", func(fl validator.FieldLevel) bool {
-		value := fl.Field().String()
-		return strings.HasPrefix(value, "/")
+	_ = validate.RegisterValidation("memory_size", func(fl validator.FieldLevel) bool {
+		return memorySizeRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("nginx_size", func(fl validator.FieldLevel) bool {
+		return nginxSizeRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("nginx_time", func(fl validator.FieldLevel) bool {
+		return nginxTimeRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("nginx_rate", func(fl validator.FieldLevel) bool {
+		return nginxRateRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("header_name", func(fl validator.FieldLevel) bool {
+		return headerNameRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("header_value", func(fl validator.FieldLevel) bool {
+		return !strings.ContainsAny(fl.Field().String(), "\r\n")
+	})
+
+	_ = validate.RegisterValidation("htpasswd_entry", func(fl validator.FieldLevel) bool {
+		return htpasswdEntryRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("nginx_snippet", func(fl validator.FieldLevel) bool {
+		return balancedBraces(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("static_name", func(fl validator.FieldLevel) bool {
+		return staticNameRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("job_name", func(fl validator.FieldLevel) bool {
+		return staticNameRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("cron_schedule", func(fl validator.FieldLevel) bool {
+		return validCronSchedule(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("env_name", func(fl validator.FieldLevel) bool {
+		return envNameRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("env_value", func(fl validator.FieldLevel) bool {
+		return !strings.ContainsAny(fl.Field().String(), "\r\n")
+	})
+
+	_ = validate.RegisterValidation("restart_policy", func(fl validator.FieldLevel) bool {
+		return restartPolicyRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("ulimit_name", func(fl validator.FieldLevel) bool {
+		return ulimitNameRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("ulimit_value", func(fl validator.FieldLevel) bool {
+		return ulimitValueRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("capability", func(fl validator.FieldLevel) bool {
+		return capabilityRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("platform", func(fl validator.FieldLevel) bool {
+		return platformRegex.MatchString(fl.Field().String())
+	})
+
+	_ = validate.RegisterValidation("label_key", func(fl validator.FieldLevel) bool {
+		key := fl.Field().String()
+		return key != "" && !strings.HasPrefix(key, "ftl.")
 	})
 
 	if err := validate.Struct(config); err != nil {
 		return nil, fmt.Errorf("validation error: %v", err)
 	}
 
+	if err := validateTLS(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validatePublicPorts(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateProxySupport(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateRoutes(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateJobs(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateVolumes(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateBackups(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateBuilds(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateWorkers(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
+	if err := validateHealthChecks(&config); err != nil {
+		return nil, fmt.Errorf("validation error: %v", err)
+	}
+
 	return &config, nil
 }
 
+var (
+	memorySizeRegex    = regexp.MustCompile(`^[0-9]+[bkmgBKMG]?$`)
+	nginxSizeRegex     = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+	nginxTimeRegex     = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|M|y)?)+$`)
+	nginxRateRegex     = regexp.MustCompile(`^[0-9]+r/[sm]$`)
+	headerNameRegex    = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	htpasswdEntryRegex = regexp.MustCompile(`^[^:\s]+:\S+$`)
+	staticNameRegex    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+	volumeNameRegex    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	envNameRegex       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	restartPolicyRegex = regexp.MustCompile(`^(no|always|unless-stopped|on-failure(:[0-9]+)?)$`)
+	ulimitNameRegex    = regexp.MustCompile(`^[a-z]+$`)
+	ulimitValueRegex   = regexp.MustCompile(`^-?[0-9]+(:-?[0-9]+)?$`)
+	capabilityRegex    = regexp.MustCompile(`^[A-Za-z_]+$`)
+	platformRegex      = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+	cronFieldRegex     = regexp.MustCompile(`^(\*|[0-9]+(-[0-9]+)?)(/[0-9]+)?(,(\*|[0-9]+(-[0-9]+)?)(/[0-9]+)?)*$`)
+)
+
+// validCronSchedule reports whether schedule is a five-field cron expression:
+// minute, hour, day of month, month and day of week.
+func validCronSchedule(schedule string) bool {
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return false
+	}
+
+	for _, field := range fields {
+		if !cronFieldRegex.MatchString(field) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// balancedBraces reports whether every block opened in a raw nginx snippet is
+// closed again, so a snippet can't escape the location or server it's placed in.
+func balancedBraces(snippet string) bool {
+	depth := 0
+	for _, r := range snippet {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+
+	return depth == 0
+}
+
+// validateTLS checks that a custom certificate and key are each given exactly
+// once, either in the config or through an environment variable.
+func validateTLS(config *Config) error {
+	if config.TLS.Mode != "custom" {
+		return nil
+	}
+
+	if (config.TLS.Certificate == "") == (config.TLS.CertificateEnv == "") {
+		return fmt.Errorf("tls: custom mode needs either certificate or certificate_env")
+	}
+	if (config.TLS.Key == "") == (config.TLS.KeyEnv == "") {
+		return fmt.Errorf("tls: custom mode needs either key or key_env")
+	}
+
+	return nil
+}
+
+// validateProxySupport rejects options the selected proxy type can't serve.
+func validateProxySupport(config *Config) error {
+	if !config.Proxy.IsEnabled() {
+		for _, service := range config.Services {
+			if service.IsStream() {
+				return fmt.Errorf("service %s: %s services need the managed proxy, which is disabled", service.Name, service.Protocol)
+			}
+		}
+
+		if len(config.Static) > 0 {
+			return fmt.Errorf("static site %s needs the managed proxy, which is disabled", config.Static[0].Name)
+		}
+
+		return nil
+	}
+
+	if config.Proxy.Type != "caddy" {
+		return nil
+	}
+
+	for _, service := range config.Services {
+		if service.IsStream() {
+			return fmt.Errorf("service %s: %s services are not supported by the caddy proxy", service.Name, service.Protocol)
+		}
+
+		for _, route := range service.Routes {
+			if route.RateLimit != nil {
+				return fmt.Errorf("service %s: rate_limit on route %s is not supported by the caddy proxy", service.Name, route.PathPrefix)
+			}
+
+			// Caddy checks basic auth passwords against bcrypt hashes only, unlike
+			// Nginx, which also takes the apr1 and SHA hashes htpasswd writes.
+			if route.BasicAuth != nil {
+				for _, user := range route.BasicAuth.Users {
+					name, hash, _ := strings.Cut(user, ":")
+					if !strings.HasPrefix(hash, "$2") {
+						return fmt.Errorf("service %s: basic_auth user %s on route %s needs a bcrypt hash for the caddy proxy", service.Name, name, route.PathPrefix)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateRoutes rejects static sites whose name or path prefix is already taken,
+// since the proxy can only serve one location per prefix.
+func validateRoutes(config *Config) error {
+	prefixes := make(map[string]string)
+	for _, service := range config.Services {
+		for _, route := range service.Routes {
+			prefixes[route.PathPrefix] = "service " + service.Name
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, static := range config.Static {
+		if names[static.Name] {
+			return fmt.Errorf("static site %s is defined more than once", static.Name)
+		}
+		names[static.Name] = true
+
+		if owner, ok := prefixes[static.PathPrefix]; ok {
+			return fmt.Errorf("static site %s: route %s is already used by %s", static.Name, static.PathPrefix, owner)
+		}
+		prefixes[static.PathPrefix] = "static site " + static.Name
+	}
+
+	return nil
+}
+
+// validateJobs rejects jobs defined more than once, since a job is run and looked
+// up by name, and services or dependencies named like the scheduler container
+// that runs the jobs.
+func validateJobs(config *Config) error {
+	for _, service := range config.Services {
+		if service.Name == SchedulerName {
+			return fmt.Errorf("service %s: the name is reserved for the job scheduler", service.Name)
+		}
+	}
+	for _, dependency := range config.Dependencies {
+		if dependency.Name == SchedulerName {
+			return fmt.Errorf("dependency %s: the name is reserved for the job scheduler", dependency.Name)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, job := range config.Jobs {
+		if names[job.Name] {
+			return fmt.Errorf("job %s is defined more than once", job.Name)
+		}
+		names[job.Name] = true
+	}
+
+	return nil
+}
+
+// validateVolumes checks that named volumes are defined once in the top-level
+// list and that the mounts of every container refer to them.
+func validateVolumes(config *Config) error {
+	defined := make(map[string]bool)
+	for _, volume := range config.Volumes {
+		if defined[volume.Name] {
+			return fmt.Errorf("volume %s is defined more than once", volume.Name)
+		}
+		defined[volume.Name] = true
+	}
+
+	check := func(owner string, mounts []Mount) error {
+		targets := make(map[string]bool)
+		for _, mount := range mounts {
+			if mount.Type == MountVolume && !defined[mount.Source] {
+				return fmt.Errorf("%s: volume %s is not defined in volumes", owner, mount.Source)
+			}
+			if mount.Size != "" && mount.Type != MountTmpfs {
+				return fmt.Errorf("%s: size is only supported for tmpfs mounts, not %s", owner, mount)
+			}
+			if targets[mount.Target] {
+				return fmt.Errorf("%s: %s is mounted more than once", owner, mount.Target)
+			}
+			targets[mount.Target] = true
+		}
+		return nil
+	}
+
+	if err := check("proxy", config.Proxy.Volumes); err != nil {
+		return err
+	}
+	for _, service := range config.Services {
+		if err := check("service "+service.Name, service.Volumes); err != nil {
+			return err
+		}
+	}
+	for _, dependency := range config.Dependencies {
+		if err := check("dependency "+dependency.Name, dependency.Volumes); err != nil {
+			return err
+		}
+	}
+	for _, job := range config.Jobs {
+		if err := check("job "+job.Name, job.Volumes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateBackups checks that backups refer to volumes of the project, and that
+// the jobs taking them don't clash with the project's own jobs.
+func validateBackups(config *Config) error {
+	jobs := make(map[string]bool)
+	for _, job := range config.Jobs {
+		jobs[job.Name] = true
+	}
+
+	defined := make(map[string]bool)
+	for _, volume := range config.Volumes {
+		defined[volume.Name] = true
+	}
+
+	volumes := make(map[string]bool)
+	for _, backup := range config.Backups {
+		if !defined[backup.Volume] {
+			return fmt.Errorf("backup of %s: volume is not defined in volumes", backup.Volume)
+		}
+		if !staticNameRegex.MatchString(backup.Volume) {
+			return fmt.Errorf("backup of %s: volume name can only contain letters, digits, '-' and '_'", backup.Volume)
+		}
+		if volumes[backup.Volume] {
+			return fmt.Errorf("volume %s is backed up more than once", backup.Volume)
+		}
+		volumes[backup.Volume] = true
+
+		if jobs[backup.JobName()] {
+			return fmt.Errorf("backup of %s: job name %s is already used", backup.Volume, backup.JobName())
+		}
+	}
+
+	return nil
+}
+
+// validateBuilds rejects build options that can't work with the build mode.
+// Remote builds run on the servers, where local secrets aren't available and the
+// image is built for the server's own platform. Loaded images are stored in the
+// local Docker, which holds one platform per image.
+func validateBuilds(config *Config) error {
+	for _, service := range config.Services {
+		if service.Build == nil {
+			continue
+		}
+
+		switch service.BuildMode() {
+		case BuildRemote:
+			if len(service.Build.Secrets) > 0 {
+				return fmt.Errorf("service %s: build secrets are not supported with build mode remote", service.Name)
+			}
+			if len(service.Build.Platforms) > 0 {
+				return fmt.Errorf("service %s: build platforms are not supported with build mode remote", service.Name)
+			}
+			if dockerfile := service.Build.Dockerfile; filepath.IsAbs(dockerfile) || strings.HasPrefix(filepath.Clean(dockerfile), "..") {
+				return fmt.Errorf("service %s: dockerfile must be inside the build context with build mode remote", service.Name)
+			}
+		case BuildLoad:
+			if len(service.Build.Platforms) > 1 {
+				return fmt.Errorf("service %s: build mode load supports a single platform", service.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateWorkers rejects proxy settings on workers, since nothing is routed to them.
+func validateWorkers(config *Config) error {
+	for _, service := range config.Services {
+		if !service.IsWorker() {
+			continue
+		}
+
+		if len(service.Routes) > 0 {
+			return fmt.Errorf("service %s: workers can't have routes", service.Name)
+		}
+		if service.IsStream() {
+			return fmt.Errorf("service %s: workers can't be exposed as %s streams", service.Name, service.Protocol)
+		}
+	}
+
+	return nil
+}
+
+// validateHealthChecks rejects network health checks that don't say which port to
+// probe, on dependencies and workers that have no port of their own.
+func validateHealthChecks(config *Config) error {
+	for _, service := range config.Services {
+		healthCheck := service.HealthCheck
+		if healthCheck == nil || healthCheck.Type == "cmd" || healthCheck.Port != 0 || service.Port != 0 {
+			continue
+		}
+
+		return fmt.Errorf("service %s: health_check.port is required for %s checks", service.Name, healthCheck.Type)
+	}
+
+	for _, dependency := range config.Dependencies {
+		healthCheck := dependency.HealthCheck
+		if healthCheck == nil || healthCheck.Type == "cmd" || healthCheck.Port != 0 {
+			continue
+		}
+
+		return fmt.Errorf("dependency %s: health_check.port is required for %s checks", dependency.Name, healthCheck.Type)
+	}
+
+	return nil
+}
+
+func validatePublicPorts(config *Config) error {
+	httpPort, httpsPort := config.Proxy.Ports()
+	used := map[string]string{
+		fmt.Sprintf("%d/tcp", httpPort):  "proxy",
+		fmt.Sprintf("%d/tcp", httpsPort): "proxy",
+	}
+
+	for _, service := range config.Services {
+		if !service.IsStream() {
+			continue
+		}
+
+		key := fmt.Sprintf("%d/%s", service.PublicPort, service.Protocol)
+		if owner, ok := used[key]; ok {
+			return fmt.Errorf("service %s: public port %s is already used by %s", service.Name, key, owner)
+		}
+		used[key] = service.Name
+	}
+
+	return nil
+}
+
+// expandEnv substitutes environment variables like os.ExpandEnv, but leaves "$$"
+// as a literal "$" so nginx variables and password hashes can be written in the config.
+func expandEnv(data string) string {
+	const placeholder = "\x00ftl-dollar\x00"
+
+	escaped := strings.ReplaceAll(data, "$$", placeholder)
+	expanded := os.ExpandEnv(escaped)
+
+	return strings.ReplaceAll(expanded, placeholder, "$")
+}
+
 func (s *Service) Hash() (string, error) {
 	sortedService := s.sortServiceFields()
 	bytes, err := json.Marshal(sortedService)
@@ -141,6 +1039,76 @@ func (s *Service) Hash() (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
+// Hash identifies the container a dependency runs in. Only the fields that shape
+// the container are hashed, and unset values are left out, so the hash of an
+// unchanged dependency stays the same when fields are added to the config.
+func (d *Dependency) Hash() (string, error) {
+	volumes := make([]string, len(d.Volumes))
+	for i, mount := range d.Volumes {
+		volumes[i] = mount.String()
+	}
+	sort.Strings(volumes)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"image":        d.Image,
+		"volumes":      volumes,
+		"env":          d.EnvVars,
+		"health_check": d.HealthCheck,
+		"runtime":      d.Runtime,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal dependency: %w", err)
+	}
+
+	var spec interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return "", fmt.Errorf("failed to marshal dependency: %w", err)
+	}
+
+	if data, err = json.Marshal(withoutZeroValues(spec)); err != nil {
+		return "", fmt.Errorf("failed to marshal dependency: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// withoutZeroValues removes the null, false, zero and empty values from decoded
+// JSON, and returns nil when nothing is left.
+func withoutZeroValues(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if item = withoutZeroValues(item); item == nil {
+				delete(value, key)
+			} else {
+				value[key] = item
+			}
+		}
+		if len(value) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			return nil
+		}
+	case string:
+		if value == "" {
+			return nil
+		}
+	case float64:
+		if value == 0 {
+			return nil
+		}
+	case bool:
+		if !value {
+			return nil
+		}
+	}
+
+	return value
+}
+
 func (s *Service) sortServiceFields() map[string]interface{} {
 	sorted := make(map[string]interface{})
 	v := reflect.ValueOf(*s)
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -17,6 +19,34 @@ func TestConfigSuite(t *testing.T) {
 	suite.Run(t, new(ConfigTestSuite))
 }
 
+// testConfig returns a config with a project and a server, followed by the
+// sections under test.
+func testConfig(sections string) []byte {
+	return []byte(`
+project:
+  name: "test-project"
+  domain: "example.com"
+  email: "test@example.com"
+servers:
+  - host: "example.com"
+    port: 22
+    user: "deploy"
+    ssh_key: "~/.ssh/id_rsa"
+` + sections)
+}
+
+// webService is a section with a single web service and no dependencies, for the
+// tests of other sections.
+const webService = `
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+dependencies: []
+`
+
 func (suite *ConfigTestSuite) TestParseConfig_Success() {
 	yamlPath := filepath.Join("sample", "ftl.yaml")
 	yamlData, err := os.ReadFile(yamlPath)
@@ -40,9 +70,9 @@ func (suite *ConfigTestSuite) TestParseConfig_Success() {
 	assert.Equal(suite.T(), "my-app-db", config.Dependencies[0].Name)
 	assert.Equal(suite.T(), "my-app-db:latest", config.Dependencies[0].Image)
 	assert.Len(suite.T(), config.Dependencies[0].Volumes, 1)
-	assert.Equal(suite.T(), "my-app-db:/var/www/html/db", config.Dependencies[0].Volumes[0])
+	assert.Equal(suite.T(), Mount{Type: MountVolume, Source: "my-app-db", Target: "/var/www/html/db"}, config.Dependencies[0].Volumes[0])
 	assert.Len(suite.T(), config.Volumes, 1)
-	assert.Equal(suite.T(), "my-app-db", config.Volumes[0])
+	assert.Equal(suite.T(), "my-app-db", config.Volumes[0].Name)
 }
 
 func (suite *ConfigTestSuite) TestParseConfig_InvalidYAML() {
@@ -156,3 +186,1325 @@ volumes:
 	assert.Contains(suite.T(), err.Error(), "validation error")
 	assert.Contains(suite.T(), err.Error(), "Config.Dependencies[0].Volumes[0]")
 }
+
+func (suite *ConfigTestSuite) TestParseConfig_StreamService() {
+	yamlData := testConfig(`
+services:
+  - name: "mqtt"
+    image: "eclipse-mosquitto:2"
+    port: 1883
+    protocol: "tcp"
+    public_port: 1883
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "tcp", config.Services[0].Protocol)
+	assert.Equal(suite.T(), 1883, config.Services[0].PublicPort)
+	assert.True(suite.T(), config.Services[0].IsStream())
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_StreamServiceInvalid() {
+	tests := []struct {
+		name     string
+		services string
+		expected string
+	}{
+		{
+			name: "missing public port",
+			services: `
+  - name: "mqtt"
+    image: "eclipse-mosquitto:2"
+    port: 1883
+    protocol: "tcp"`,
+			expected: "Config.Services[0].PublicPort",
+		},
+		{
+			name: "unknown protocol",
+			services: `
+  - name: "mqtt"
+    image: "eclipse-mosquitto:2"
+    port: 1883
+    protocol: "sctp"
+    public_port: 1883`,
+			expected: "Config.Services[0].Protocol",
+		},
+		{
+			name: "public port taken by proxy",
+			services: `
+  - name: "tls"
+    image: "haproxy:2"
+    port: 443
+    protocol: "tcp"
+    public_port: 443`,
+			expected: "public port 443/tcp is already used by proxy",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:` + tt.services + `
+dependencies: []
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_Worker() {
+	yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+  - name: "consumer"
+    image: "my-app:latest"
+    kind: worker
+    health_check:
+      type: cmd
+      command: "test -f /tmp/alive"
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "web", config.Services[0].Kind)
+	assert.False(suite.T(), config.Services[0].IsWorker())
+	assert.True(suite.T(), config.Services[1].IsWorker())
+	assert.Zero(suite.T(), config.Services[1].Port)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_WorkerInvalid() {
+	tests := []struct {
+		name     string
+		services string
+		expected string
+	}{
+		{
+			name: "web without port",
+			services: `
+  - name: "web"
+    image: "nginx:latest"
+    routes:
+      - path: "/"`,
+			expected: "Config.Services[0].Port",
+		},
+		{
+			name: "unknown kind",
+			services: `
+  - name: "cron"
+    image: "my-app:latest"
+    kind: "cron"`,
+			expected: "Config.Services[0].Kind",
+		},
+		{
+			name: "worker with routes",
+			services: `
+  - name: "consumer"
+    image: "my-app:latest"
+    kind: worker
+    routes:
+      - path: "/"`,
+			expected: "workers can't have routes",
+		},
+		{
+			name: "worker as stream",
+			services: `
+  - name: "consumer"
+    image: "my-app:latest"
+    kind: worker
+    port: 1883
+    protocol: tcp
+    public_port: 1883`,
+			expected: "workers can't be exposed as tcp streams",
+		},
+		{
+			name: "http health check without port",
+			services: `
+  - name: "consumer"
+    image: "my-app:latest"
+    kind: worker
+    health_check:
+      path: "/health"`,
+			expected: "health_check.port is required for http checks",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:` + tt.services + `
+dependencies: []
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_Jobs() {
+	yamlData := testConfig(webService + `
+jobs:
+  - name: "nightly-report"
+    schedule: "0 3 * * 1-5"
+    image: "my-app:latest"
+    command: ["bin/report", "--daily"]
+    env:
+      REPORT_EMAIL: "ops@example.com"
+    volumes:
+      - "reports:/reports"
+  - name: "cleanup"
+    schedule: "*/15 * * * *"
+    image: "my-app:latest"
+volumes:
+  - "reports"
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), config.Jobs, 2)
+	assert.Equal(suite.T(), []string{"bin/report", "--daily"}, config.Jobs[0].Command)
+	assert.Equal(suite.T(), "ops@example.com", config.Jobs[0].EnvVars["REPORT_EMAIL"])
+	assert.Equal(suite.T(), "*/15 * * * *", config.Jobs[1].Schedule)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_SchedulerNameReserved() {
+	yamlData := testConfig(`
+services:
+  - name: "scheduler"
+    image: "my-app:latest"
+    kind: "worker"
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.Error(suite.T(), err)
+	assert.Nil(suite.T(), config)
+	assert.Contains(suite.T(), err.Error(), "service scheduler: the name is reserved for the job scheduler")
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_JobsInvalid() {
+	tests := []struct {
+		name     string
+		jobs     string
+		expected string
+	}{
+		{
+			name: "schedule with too few fields",
+			jobs: `
+  - name: "report"
+    schedule: "0 3 * *"
+    image: "my-app:latest"`,
+			expected: "Config.Jobs[0].Schedule",
+		},
+		{
+			name: "schedule macro",
+			jobs: `
+  - name: "report"
+    schedule: "@daily"
+    image: "my-app:latest"`,
+			expected: "Config.Jobs[0].Schedule",
+		},
+		{
+			name: "invalid name",
+			jobs: `
+  - name: "../report"
+    schedule: "0 3 * * *"
+    image: "my-app:latest"`,
+			expected: "Config.Jobs[0].Name",
+		},
+		{
+			name: "missing image",
+			jobs: `
+  - name: "report"
+    schedule: "0 3 * * *"`,
+			expected: "Config.Jobs[0].Image",
+		},
+		{
+			name: "invalid env name",
+			jobs: `
+  - name: "report"
+    schedule: "0 3 * * *"
+    image: "my-app:latest"
+    env:
+      "BAD NAME": "x"`,
+			expected: "Config.Jobs[0].EnvVars",
+		},
+		{
+			name: "duplicate name",
+			jobs: `
+  - name: "report"
+    schedule: "0 3 * * *"
+    image: "my-app:latest"
+  - name: "report"
+    schedule: "0 4 * * *"
+    image: "my-app:latest"`,
+			expected: "job report is defined more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(webService + `
+jobs:` + tt.jobs + `
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_Volumes() {
+	yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+    volumes:
+      - "uploads:/app/uploads"
+      - "./config/app.yml:/app/config.yml:ro"
+      - "/var/log/web:/app/log"
+      - type: tmpfs
+        target: /app/tmp
+        size: 64m
+      - source: shared
+        target: /app/shared
+        read_only: true
+dependencies: []
+volumes:
+  - "uploads"
+  - name: "shared"
+    driver: "local"
+    driver_opts:
+      type: "nfs"
+      o: "addr=10.0.0.2,rw"
+      device: ":/exports/shared"
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []Mount{
+		{Type: MountVolume, Source: "uploads", Target: "/app/uploads"},
+		{Type: MountBind, Source: "./config/app.yml", Target: "/app/config.yml", ReadOnly: true},
+		{Type: MountBind, Source: "/var/log/web", Target: "/app/log"},
+		{Type: MountTmpfs, Target: "/app/tmp", Size: "64m"},
+		{Type: MountVolume, Source: "shared", Target: "/app/shared", ReadOnly: true},
+	}, config.Services[0].Volumes)
+	assert.Equal(suite.T(), []Volume{
+		{Name: "uploads"},
+		{Name: "shared", Driver: "local", DriverOpts: map[string]string{
+			"type": "nfs", "o": "addr=10.0.0.2,rw", "device": ":/exports/shared",
+		}},
+	}, config.Volumes)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_VolumesInvalid() {
+	tests := []struct {
+		name     string
+		mounts   string
+		expected string
+	}{
+		{
+			name:     "missing target",
+			mounts:   `["uploads"]`,
+			expected: "Config.Services[0].Volumes[0].Target",
+		},
+		{
+			name:     "relative target",
+			mounts:   `["uploads:app"]`,
+			expected: "Config.Services[0].Volumes[0].Target",
+		},
+		{
+			name:     "invalid mode",
+			mounts:   `["uploads:/app/uploads:z"]`,
+			expected: `invalid volume "uploads:/app/uploads:z": mode must be ro or rw`,
+		},
+		{
+			name:     "undefined volume",
+			mounts:   `["cache:/app/cache"]`,
+			expected: "service web: volume cache is not defined in volumes",
+		},
+		{
+			name:     "tmpfs with source",
+			mounts:   `[{type: tmpfs, source: uploads, target: /app/tmp}]`,
+			expected: "Config.Services[0].Volumes[0].Source",
+		},
+		{
+			name:     "size on a volume",
+			mounts:   `[{source: uploads, target: /app/uploads, size: 64m}]`,
+			expected: "service web: size is only supported for tmpfs mounts, not uploads:/app/uploads:size=64m",
+		},
+		{
+			name:     "comma in path",
+			mounts:   `["/srv/a,b:/app/data"]`,
+			expected: "Config.Services[0].Volumes[0].Source",
+		},
+		{
+			name:     "target mounted twice",
+			mounts:   `["uploads:/app/data", "/srv/data:/app/data"]`,
+			expected: "service web: /app/data is mounted more than once",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+    volumes: ` + tt.mounts + `
+dependencies: []
+volumes:
+  - "uploads"
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_BuildMode() {
+	parse := func(build string) (*Config, error) {
+		return ParseConfig(testConfig(`
+services:
+  - name: "web"
+    image: "web:latest"
+    port: 80
+    routes:
+      - path: "/"
+` + build + `
+dependencies: []
+`))
+	}
+
+	config, err := parse("")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BuildRegistry, config.Services[0].BuildMode())
+
+	config, err = parse("    build:\n      mode: remote")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BuildRemote, config.Services[0].BuildMode())
+
+	_, err = parse("    build:\n      mode: rsync")
+	assert.Error(suite.T(), err)
+	assert.Contains(suite.T(), err.Error(), "Config.Services[0].Build.Mode")
+
+	config, err = parse(`    build:
+      dockerfile: Dockerfile.prod
+      context: ./app
+      target: runtime
+      args:
+        VERSION: "1.2.3"
+      platforms: [linux/amd64, linux/arm/v7]
+      secrets:
+        - id: npmrc
+          src: ./.npmrc
+        - id: token
+          env: NPM_TOKEN
+      cache_from: ["type=registry,ref=web:cache"]
+      cache_to: ["type=inline"]`)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), &Build{
+		Dockerfile: "Dockerfile.prod",
+		Context:    "./app",
+		Target:     "runtime",
+		Args:       map[string]string{"VERSION": "1.2.3"},
+		Platforms:  []string{"linux/amd64", "linux/arm/v7"},
+		Secrets:    []BuildSecret{{ID: "npmrc", Src: "./.npmrc"}, {ID: "token", Env: "NPM_TOKEN"}},
+		CacheFrom:  []string{"type=registry,ref=web:cache"},
+		CacheTo:    []string{"type=inline"},
+	}, config.Services[0].Build)
+	assert.Equal(suite.T(), "./app", config.Services[0].BuildContext())
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_BuildInvalid() {
+	tests := []struct {
+		name     string
+		build    string
+		expected string
+	}{
+		{
+			name:     "invalid platform",
+			build:    `{platforms: [arm64]}`,
+			expected: "Config.Services[0].Build.Platforms[0]",
+		},
+		{
+			name:     "secret without source",
+			build:    `{secrets: [{id: npmrc}]}`,
+			expected: "Config.Services[0].Build.Secrets[0].Src",
+		},
+		{
+			name:     "secret with file and env",
+			build:    `{secrets: [{id: npmrc, src: ./.npmrc, env: NPMRC}]}`,
+			expected: "Config.Services[0].Build.Secrets[0].Src",
+		},
+		{
+			name:     "remote with secrets",
+			build:    `{mode: remote, secrets: [{id: token, env: NPM_TOKEN}]}`,
+			expected: "service web: build secrets are not supported with build mode remote",
+		},
+		{
+			name:     "remote with platforms",
+			build:    `{mode: remote, platforms: [linux/arm64]}`,
+			expected: "service web: build platforms are not supported with build mode remote",
+		},
+		{
+			name:     "remote with dockerfile outside the context",
+			build:    `{mode: remote, dockerfile: ../Dockerfile}`,
+			expected: "service web: dockerfile must be inside the build context with build mode remote",
+		},
+		{
+			name:     "load with several platforms",
+			build:    `{mode: load, platforms: [linux/amd64, linux/arm64]}`,
+			expected: "service web: build mode load supports a single platform",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "web:latest"
+    port: 80
+    routes:
+      - path: "/"
+    build: ` + tt.build + `
+dependencies: []
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestMount_Hash() {
+	short := Service{Name: "web", Image: "nginx", Volumes: []Mount{{Type: MountVolume, Source: "uploads", Target: "/app/uploads"}}}
+	shortHash, err := short.Hash()
+	assert.NoError(suite.T(), err)
+
+	legacyJSON, _ := json.Marshal([]string{"uploads:/app/uploads"})
+	mountJSON, _ := json.Marshal(short.Volumes)
+	assert.JSONEq(suite.T(), string(legacyJSON), string(mountJSON), "mounts hash like the short form they were written in")
+
+	short.Volumes[0].ReadOnly = true
+	readOnlyHash, err := short.Hash()
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), shortHash, readOnlyHash)
+}
+
+func (suite *ConfigTestSuite) TestDependency_Hash() {
+	dependency := Dependency{
+		Name:        "postgres",
+		Image:       "postgres:16",
+		Volumes:     []Mount{{Type: MountVolume, Source: "db_data", Target: "/var/lib/postgresql/data"}},
+		EnvVars:     map[string]string{"POSTGRES_DB": "app", "POSTGRES_PASSWORD": "secret"},
+		HealthCheck: &HealthCheck{Type: "cmd", Command: "pg_isready", Interval: 2 * time.Second, Timeout: time.Second, Retries: 15, Mode: "container"},
+		Runtime:     Runtime{Memory: "1g"},
+		PreRecreate: "pg_dumpall -U postgres > /backup.sql",
+	}
+
+	// The hash is labelled on running containers, so it must not change for an
+	// unchanged dependency, not even when fields are added to the config.
+	hash, err := dependency.Hash()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "46abc82c92fdf8b32a10158921152431941029f7e345fb9af5fc218fe96efd7c", hash)
+
+	dependency.PreRecreate = ""
+	unchanged, err := dependency.Hash()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), hash, unchanged, "the pre_recreate hook doesn't shape the container")
+
+	dependency.Memory = "2g"
+	changed, err := dependency.Hash()
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), hash, changed)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_Backups() {
+	yamlData := testConfig(webService + `
+volumes:
+  - "db_data"
+  - "uploads"
+backups:
+  - volume: "db_data"
+    schedule: "0 2 * * *"
+    keep: 14
+  - volume: "uploads"
+    schedule: "30 2 * * 0"
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), config.Backups, 2)
+	assert.Equal(suite.T(), 14, config.Backups[0].Keep)
+	assert.Equal(suite.T(), 7, config.Backups[1].Keep)
+	assert.Equal(suite.T(), "backup-uploads", config.Backups[1].JobName())
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_BackupsInvalid() {
+	tests := []struct {
+		name     string
+		backups  string
+		expected string
+	}{
+		{
+			name: "undefined volume",
+			backups: `
+  - volume: "uploads"
+    schedule: "0 2 * * *"`,
+			expected: "backup of uploads: volume is not defined in volumes",
+		},
+		{
+			name: "invalid schedule",
+			backups: `
+  - volume: "db_data"
+    schedule: "daily"`,
+			expected: "Config.Backups[0].Schedule",
+		},
+		{
+			name: "negative keep",
+			backups: `
+  - volume: "db_data"
+    schedule: "0 2 * * *"
+    keep: -1`,
+			expected: "Config.Backups[0].Keep",
+		},
+		{
+			name: "volume backed up twice",
+			backups: `
+  - volume: "db_data"
+    schedule: "0 2 * * *"
+  - volume: "db_data"
+    schedule: "0 3 * * *"`,
+			expected: "volume db_data is backed up more than once",
+		},
+		{
+			name: "job name clash",
+			backups: `
+  - volume: "db_data"
+    schedule: "0 2 * * *"
+jobs:
+  - name: "backup-db_data"
+    schedule: "0 3 * * *"
+    image: "my-app:latest"`,
+			expected: "backup of db_data: job name backup-db_data is already used",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(webService + `
+volumes:
+  - "db_data"
+backups:` + tt.backups + `
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_Runtime() {
+	yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    restart: always
+    memory: 512m
+    user: "101"
+    command: ["nginx", "-g", "daemon off;"]
+    ulimits:
+      nofile: "1024:65536"
+    cap_drop: [ALL]
+    cap_add: [NET_BIND_SERVICE]
+    read_only: true
+    tmpfs: ["/var/cache/nginx", "/run"]
+    labels:
+      team: web
+    logging:
+      driver: json-file
+      options:
+        max-size: 10m
+    routes:
+      - path: "/"
+dependencies:
+  - name: "postgres"
+    image: "postgres:16"
+    restart: on-failure:3
+    entrypoint: ["docker-entrypoint.sh"]
+    command: ["postgres", "-c", "max_connections=200"]
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	web := config.Services[0]
+	assert.Equal(suite.T(), "always", web.Restart)
+	assert.Equal(suite.T(), "512m", web.Memory)
+	assert.Equal(suite.T(), []string{"nginx", "-g", "daemon off;"}, web.Command)
+	assert.Equal(suite.T(), "1024:65536", web.Ulimits["nofile"])
+	assert.True(suite.T(), web.ReadOnly)
+	assert.Equal(suite.T(), "json-file", web.Logging.Driver)
+	assert.Equal(suite.T(), "on-failure:3", config.Dependencies[0].Restart)
+	assert.Equal(suite.T(), []string{"docker-entrypoint.sh"}, config.Dependencies[0].Entrypoint)
+
+	before, err := web.Hash()
+	assert.NoError(suite.T(), err)
+	web.CapAdd = append(web.CapAdd, "SYS_TIME")
+	after, err := web.Hash()
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), before, after, "runtime options are part of the config hash")
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_RuntimeInvalid() {
+	tests := []struct {
+		name     string
+		options  string
+		expected string
+	}{
+		{name: "restart policy", options: `restart: sometimes`, expected: "Config.Services[0].Runtime.Restart"},
+		{name: "ulimit value", options: "ulimits:\n      nofile: lots", expected: "Config.Services[0].Runtime.Ulimits"},
+		{name: "capability", options: `cap_add: ["NET ADMIN"]`, expected: "Config.Services[0].Runtime.CapAdd[0]"},
+		{name: "tmpfs path", options: `tmpfs: ["tmp"]`, expected: "Config.Services[0].Runtime.Tmpfs[0]"},
+		{name: "reserved label", options: "labels:\n      ftl.config-hash: x", expected: "Config.Services[0].Runtime.Labels"},
+		{name: "logging without driver", options: "logging:\n      options:\n        max-size: 10m", expected: "Config.Services[0].Runtime.Logging.Driver"},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    ` + tt.options + `
+    routes:
+      - path: "/"
+dependencies: []
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_RouteOptionsInvalid() {
+	tests := []struct {
+		name     string
+		route    string
+		expected string
+	}{
+		{
+			name:     "invalid body size",
+			route:    `client_max_body_size: "ten megabytes"`,
+			expected: "ClientMaxBodySize",
+		},
+		{
+			name:     "invalid read timeout",
+			route:    `proxy_read_timeout: "1 minute"`,
+			expected: "ProxyReadTimeout",
+		},
+		{
+			name: "invalid header name",
+			route: `request_headers:
+          "X Bad Header": "value"`,
+			expected: "RequestHeaders",
+		},
+		{
+			name: "invalid allow entry",
+			route: `allow:
+          - "not-an-ip"`,
+			expected: "Allow[0]",
+		},
+		{
+			name: "invalid rate",
+			route: `rate_limit:
+          rate: "fast"`,
+			expected: "RateLimit.Rate",
+		},
+		{
+			name: "basic auth without users",
+			route: `basic_auth:
+          realm: "Admin"`,
+			expected: "BasicAuth.Users",
+		},
+		{
+			name:     "unbalanced snippet",
+			route:    `snippet: "location /x { return 200;"`,
+			expected: "Snippet",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+        ` + tt.route + `
+dependencies: []
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_EscapedDollar() {
+	suite.T().Setenv("FTL_TEST_IMAGE", "nginx:latest")
+
+	yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "${FTL_TEST_IMAGE}"
+    port: 80
+    routes:
+      - path: "/"
+        request_headers:
+          X-Real-IP: "$$remote_addr"
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "nginx:latest", config.Services[0].Image)
+	assert.Equal(suite.T(), "$remote_addr", config.Services[0].Routes[0].RequestHeaders["X-Real-IP"])
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_TLS() {
+	tests := []struct {
+		name     string
+		tls      string
+		expected string
+	}{
+		{
+			name:     "default mode",
+			tls:      "",
+			expected: "",
+		},
+		{
+			name: "custom certificate",
+			tls: `tls:
+  mode: custom
+  certificate: ./certs/fullchain.pem
+  key: ./certs/key.pem`,
+			expected: "",
+		},
+		{
+			name: "custom without key",
+			tls: `tls:
+  mode: custom
+  certificate: ./certs/fullchain.pem`,
+			expected: "needs either key or key_env",
+		},
+		{
+			name: "custom certificate from environment",
+			tls: `tls:
+  mode: custom
+  certificate_env: TLS_CERTIFICATE
+  key_env: TLS_KEY`,
+			expected: "",
+		},
+		{
+			name: "custom key given twice",
+			tls: `tls:
+  mode: custom
+  certificate: ./certs/fullchain.pem
+  key: ./certs/key.pem
+  key_env: TLS_KEY`,
+			expected: "needs either key or key_env",
+		},
+		{
+			name: "dns without challenge",
+			tls: `tls:
+  mode: dns`,
+			expected: "Config.TLS.DNS",
+		},
+		{
+			name: "unknown mode",
+			tls: `tls:
+  mode: manual`,
+			expected: "Config.TLS.Mode",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(webService + tt.tls)
+
+			config, err := ParseConfig(yamlData)
+
+			if tt.expected == "" {
+				assert.NoError(suite.T(), err)
+				assert.NotEmpty(suite.T(), config.TLS.Mode)
+				return
+			}
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_CaddyUnsupportedOptions() {
+	yamlData := testConfig(`
+proxy:
+  type: caddy
+services:
+  - name: "mqtt"
+    image: "eclipse-mosquitto:2"
+    port: 1883
+    protocol: "tcp"
+    public_port: 1883
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.Error(suite.T(), err)
+	assert.Nil(suite.T(), config)
+	assert.Contains(suite.T(), err.Error(), "not supported by the caddy proxy")
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_CaddyBasicAuth() {
+	parse := func(user string) (*Config, error) {
+		return ParseConfig(testConfig(`
+proxy:
+  type: caddy
+services:
+  - name: "admin"
+    image: "admin:latest"
+    port: 80
+    routes:
+      - path: "/"
+        basic_auth:
+          users:
+            - '` + user + `'
+dependencies: []
+`))
+	}
+
+	config, err := parse("admin:$$2y$$05$$c4WoMPo3SXsafkva.HHa6uXQZWr7oboPiC2bT/r7q1BB8I2s0BRqC")
+	assert.NoError(suite.T(), err)
+	assert.NotNil(suite.T(), config)
+
+	config, err = parse("admin:$$apr1$$x8f2k1aB$$0Z9k0XUJr7v7l1wSTn9Yj/")
+	assert.Error(suite.T(), err)
+	assert.Nil(suite.T(), config)
+	assert.Contains(suite.T(), err.Error(), "basic_auth user admin on route / needs a bcrypt hash for the caddy proxy")
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_ProxySection() {
+	yamlData := testConfig(`
+proxy:
+  enabled: false
+  http_port: 8080
+  https_port: 8443
+  bind_address: 127.0.0.1
+  memory: 256m
+  cpus: "0.5"
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), config.Proxy.IsEnabled())
+	httpPort, httpsPort := config.Proxy.Ports()
+	assert.Equal(suite.T(), 8080, httpPort)
+	assert.Equal(suite.T(), 8443, httpsPort)
+	assert.Equal(suite.T(), "127.0.0.1", config.Proxy.BindAddress)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_ProxySectionInvalid() {
+	tests := []struct {
+		name     string
+		proxy    string
+		expected string
+	}{
+		{
+			name: "same http and https port",
+			proxy: `proxy:
+  http_port: 8080
+  https_port: 8080`,
+			expected: "Config.Proxy.HTTPSPort",
+		},
+		{
+			name: "invalid bind address",
+			proxy: `proxy:
+  bind_address: localhost`,
+			expected: "Config.Proxy.BindAddress",
+		},
+		{
+			name: "invalid memory",
+			proxy: `proxy:
+  memory: lots`,
+			expected: "Config.Proxy.Memory",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(webService + tt.proxy)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_Static() {
+	yamlData := testConfig(`
+services:
+  - name: "api"
+    image: "api:latest"
+    port: 8080
+    routes:
+      - path: "/api"
+static:
+  - name: "frontend"
+    path: "./dist"
+    spa: true
+  - name: "docs"
+    path: "./docs/build"
+    route: "/docs"
+    cache_max_age: 24h
+    keep: 3
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), config.Static, 2)
+	assert.Equal(suite.T(), "/", config.Static[0].PathPrefix)
+	assert.Equal(suite.T(), time.Hour, config.Static[0].CacheMaxAge)
+	assert.Equal(suite.T(), 5, config.Static[0].Keep)
+	assert.True(suite.T(), config.Static[0].SPA)
+	assert.Equal(suite.T(), "/docs", config.Static[1].PathPrefix)
+	assert.Equal(suite.T(), 24*time.Hour, config.Static[1].CacheMaxAge)
+	assert.Equal(suite.T(), 3, config.Static[1].Keep)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_StaticInvalid() {
+	tests := []struct {
+		name     string
+		static   string
+		expected string
+	}{
+		{
+			name: "route taken by a service",
+			static: `static:
+  - name: "frontend"
+    path: "./dist"`,
+			expected: "route / is already used by service web",
+		},
+		{
+			name: "duplicate name",
+			static: `static:
+  - name: "docs"
+    path: "./docs"
+    route: "/docs"
+  - name: "docs"
+    path: "./guide"
+    route: "/guide"`,
+			expected: "static site docs is defined more than once",
+		},
+		{
+			name: "invalid name",
+			static: `static:
+  - name: "../docs"
+    path: "./docs"
+    route: "/docs"`,
+			expected: "Config.Static[0].Name",
+		},
+		{
+			name: "relative route",
+			static: `static:
+  - name: "docs"
+    path: "./docs"
+    route: "docs"`,
+			expected: "Config.Static[0].PathPrefix",
+		},
+		{
+			name: "proxy disabled",
+			static: `proxy:
+  enabled: false
+static:
+  - name: "docs"
+    path: "./docs"
+    route: "/docs"`,
+			expected: "static site docs needs the managed proxy",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(webService + tt.static)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_HealthChecks() {
+	yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    health_check:
+      path: "/ready"
+      expected_status: [200, 204]
+      expected_body: "ok"
+      start_period: 30s
+      mode: sidecar
+    routes:
+      - path: "/"
+dependencies:
+  - name: "postgres"
+    image: "postgres:16"
+    health_check:
+      type: cmd
+      command: "pg_isready -U postgres"
+  - name: "redis"
+    image: "redis:7"
+    health_check:
+      type: tcp
+      port: 6379
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	healthCheck := config.Services[0].HealthCheck
+	assert.Equal(suite.T(), []int{200, 204}, healthCheck.ExpectedStatus)
+	assert.Equal(suite.T(), "ok", healthCheck.ExpectedBody)
+	assert.Equal(suite.T(), 30*time.Second, healthCheck.StartPeriod)
+	assert.True(suite.T(), healthCheck.IsSidecar())
+	assert.Equal(suite.T(), "pg_isready -U postgres", config.Dependencies[0].HealthCheck.Command)
+	assert.Equal(suite.T(), 6379, config.Dependencies[1].HealthCheck.Port)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_HealthChecksInvalid() {
+	tests := []struct {
+		name        string
+		healthCheck string
+		expected    string
+	}{
+		{
+			name: "unknown type",
+			healthCheck: `    health_check:
+      type: grpc`,
+			expected: "Config.Dependencies[0].HealthCheck.Type",
+		},
+		{
+			name: "cmd without command",
+			healthCheck: `    health_check:
+      type: cmd`,
+			expected: "Config.Dependencies[0].HealthCheck.Command",
+		},
+		{
+			name: "invalid status",
+			healthCheck: `    health_check:
+      port: 6379
+      expected_status: [99]`,
+			expected: "Config.Dependencies[0].HealthCheck.ExpectedStatus[0]",
+		},
+		{
+			name: "tcp without port",
+			healthCheck: `    health_check:
+      type: tcp`,
+			expected: "dependency redis: health_check.port is required for tcp checks",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+dependencies:
+  - name: "redis"
+    image: "redis:7"
+` + tt.healthCheck)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_HealthCheckDefaults() {
+	yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    health_check: {}
+    routes:
+      - path: "/"
+  - name: "api"
+    image: "api:latest"
+    port: 8080
+    health_check:
+      path: "/health"
+      interval: 500ms
+      timeout: 250ms
+      start_period: 1.5s
+      retries: 20
+    routes:
+      - path: "/api"
+dependencies: []
+`)
+
+	config, err := ParseConfig(yamlData)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), &HealthCheck{
+		Type:     "http",
+		Path:     "/",
+		Interval: DefaultHealthCheckInterval,
+		Timeout:  DefaultHealthCheckTimeout,
+		Retries:  DefaultHealthCheckRetries,
+		Mode:     "container",
+	}, config.Services[0].HealthCheck)
+
+	healthCheck := config.Services[1].HealthCheck
+	assert.Equal(suite.T(), "/health", healthCheck.Path)
+	assert.Equal(suite.T(), 500*time.Millisecond, healthCheck.Interval)
+	assert.Equal(suite.T(), 250*time.Millisecond, healthCheck.Timeout)
+	assert.Equal(suite.T(), 1500*time.Millisecond, healthCheck.StartPeriod)
+	assert.Equal(suite.T(), 20, healthCheck.Retries)
+}
+
+func (suite *ConfigTestSuite) TestParseConfig_HealthCheckInvalidValues() {
+	tests := []struct {
+		name        string
+		healthCheck string
+		expected    string
+	}{
+		{
+			name:        "negative interval",
+			healthCheck: `interval: -1s`,
+			expected:    "Config.Services[0].HealthCheck.Interval",
+		},
+		{
+			name:        "negative retries",
+			healthCheck: `retries: -3`,
+			expected:    "Config.Services[0].HealthCheck.Retries",
+		},
+		{
+			name:        "relative path",
+			healthCheck: `path: health`,
+			expected:    "Config.Services[0].HealthCheck.Path",
+		},
+		{
+			name:        "unknown mode",
+			healthCheck: `mode: external`,
+			expected:    "Config.Services[0].HealthCheck.Mode",
+		},
+		{
+			name:        "malformed duration",
+			healthCheck: `timeout: soon`,
+			expected:    "error parsing YAML",
+		},
+	}
+
+	for _, tt := range tests {
+		suite.Run(tt.name, func() {
+			yamlData := testConfig(`
+services:
+  - name: "web"
+    image: "nginx:latest"
+    port: 80
+    routes:
+      - path: "/"
+    health_check:
+      ` + tt.healthCheck + `
+dependencies: []
+`)
+
+			config, err := ParseConfig(yamlData)
+
+			assert.Error(suite.T(), err)
+			assert.Nil(suite.T(), config)
+			assert.Contains(suite.T(), err.Error(), tt.expected)
+		})
+	}
+}
@@ -15,15 +15,72 @@ import (
 )
 
 var (
-	Info       = color.New(color.FgCyan).PrintlnFunc()
-	Success    = color.New(color.FgGreen).PrintlnFunc()
-	Warning    = color.New(color.FgYellow).PrintlnFunc()
-	ErrPrintln = color.New(color.FgRed).PrintlnFunc()
-	ErrPrintf  = color.New(color.FgRed).PrintfFunc()
-	Input      = color.New(color.FgYellow).PrintFunc()
+	infoColor    = color.New(color.FgCyan)
+	successColor = color.New(color.FgGreen)
+	warningColor = color.New(color.FgYellow)
+	errorColor   = color.New(color.FgRed)
+	inputColor   = color.New(color.FgYellow)
 )
 
+func Info(a ...interface{}) {
+	message("info", infoColor, fmt.Sprintln(a...))
+}
+
+func Success(a ...interface{}) {
+	message("success", successColor, fmt.Sprintln(a...))
+}
+
+func Warning(a ...interface{}) {
+	message("warning", warningColor, fmt.Sprintln(a...))
+}
+
+func ErrPrintln(a ...interface{}) {
+	message("error", errorColor, fmt.Sprintln(a...))
+}
+
+func ErrPrintf(format string, a ...interface{}) {
+	message("error", errorColor, fmt.Sprintf(format, a...))
+}
+
+// Input prints a prompt for interactive input. In JSON mode it goes to stderr,
+// so it doesn't corrupt the event stream.
+func Input(a ...interface{}) {
+	if mode == OutputJSON {
+		fmt.Fprint(os.Stderr, a...)
+		return
+	}
+
+	if mode == OutputPlain {
+		fmt.Print(a...)
+		return
+	}
+
+	_, _ = inputColor.Print(a...)
+}
+
+func message(level string, c *color.Color, text string) {
+	if mode == OutputJSON {
+		Emit(Event{Type: level, Message: strings.TrimRight(text, "\n")})
+		return
+	}
+
+	// Messages may come from builds running side by side.
+	outLock.Lock()
+	defer outLock.Unlock()
+
+	if mode == OutputPlain {
+		fmt.Print(text)
+		return
+	}
+
+	_, _ = c.Print(text)
+}
+
 func ProgressSpinner(ctx context.Context, initialMsg, completeMsg string, operations []func() error) error {
+	if mode != OutputText || !isTerminal() {
+		return progressSteps(ctx, initialMsg, completeMsg, operations)
+	}
+
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond)
 	s.Suffix = " " + initialMsg
 	_ = s.Color("yellow")
@@ -66,6 +123,45 @@ func ProgressSpinner(ctx context.Context, initialMsg, completeMsg string, operat
 	return nil
 }
 
+// progressSteps runs the operations like ProgressSpinner, but reports progress
+// as one line or event per state change, which reads well in CI logs.
+func progressSteps(ctx context.Context, initialMsg, completeMsg string, operations []func() error) error {
+	start := time.Now()
+
+	if mode == OutputJSON {
+		Emit(Event{Type: EventStepStarted, Step: initialMsg})
+	} else {
+		fmt.Printf("%s...\n", initialMsg)
+	}
+
+	for _, operation := range operations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := operation(); err != nil {
+			if mode == OutputJSON {
+				Emit(Event{Type: EventStepFailed, Step: initialMsg, Duration: Since(start), Error: err.Error()})
+			} else {
+				fmt.Printf("X %s failed after %s\nError: %v\n", initialMsg, time.Since(start).Round(time.Millisecond), err)
+			}
+			return fmt.Errorf("operation failed: %w", err)
+		}
+	}
+
+	if mode == OutputJSON {
+		Emit(Event{Type: EventStepFinished, Step: completeMsg, Duration: Since(start)})
+	} else {
+		fmt.Printf("√ %s (%s)\n", completeMsg, time.Since(start).Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
 func ReadLine() (string, error) {
 	reader := bufio.NewReader(os.Stdin)
 	line, err := reader.ReadString('\n')
@@ -0,0 +1,93 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Output modes selectable with the global --output flag.
+const (
+	OutputText  = "text"
+	OutputJSON  = "json"
+	OutputPlain = "plain"
+)
+
+// Event types emitted in JSON mode. Messages printed with Info, Success, Warning
+// and ErrPrintln are emitted with their level as the type.
+const (
+	EventDeployStarted     = "deploy_started"
+	EventDeployFinished    = "deploy_finished"
+	EventStepStarted       = "step_started"
+	EventStepFinished      = "step_finished"
+	EventStepFailed        = "step_failed"
+	EventServiceInstalled  = "service_installed"
+	EventServiceUpdated    = "service_updated"
+	EventServiceUnchanged  = "service_unchanged"
+	EventDependencyDrifted = "dependency_drifted"
+)
+
+// Event is a single line of the NDJSON stream written in JSON mode.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Message  string    `json:"message,omitempty"`
+	Server   string    `json:"server,omitempty"`
+	Service  string    `json:"service,omitempty"`
+	Step     string    `json:"step,omitempty"`
+	Duration *float64  `json:"duration_seconds,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var (
+	mode              = OutputText
+	out     io.Writer = os.Stdout
+	outLock sync.Mutex
+)
+
+// SetOutput selects how the console reports progress: colored text with spinners,
+// plain lines without colors or spinners, or NDJSON events.
+func SetOutput(output string) error {
+	switch output {
+	case OutputText, OutputJSON, OutputPlain:
+		mode = output
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, expected text, json or plain", output)
+	}
+}
+
+// Output returns the selected output mode.
+func Output() string {
+	return mode
+}
+
+// Emit writes an event to stdout in JSON mode. In the other modes it does nothing,
+// since their output is produced by the print helpers and spinners.
+func Emit(event Event) {
+	if mode != OutputJSON {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	outLock.Lock()
+	defer outLock.Unlock()
+	_, _ = out.Write(append(line, '\n'))
+}
+
+// Since returns the time elapsed since start in the form used by Event.Duration.
+func Since(start time.Time) *float64 {
+	seconds := time.Since(start).Seconds()
+	return &seconds
+}
@@ -0,0 +1,75 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureEvents(t *testing.T) *bytes.Buffer {
+	var buffer bytes.Buffer
+	previousMode, previousOut := mode, out
+	out = &buffer
+	require.NoError(t, SetOutput(OutputJSON))
+	t.Cleanup(func() { mode, out = previousMode, previousOut })
+
+	return &buffer
+}
+
+func decodeEvents(t *testing.T, buffer *bytes.Buffer) []Event {
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var event Event
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestSetOutput(t *testing.T) {
+	t.Cleanup(func() { mode = OutputText })
+
+	assert.NoError(t, SetOutput(OutputPlain))
+	assert.Equal(t, OutputPlain, Output())
+	assert.Error(t, SetOutput("yaml"))
+	assert.Equal(t, OutputPlain, Output())
+}
+
+func TestProgressSpinner_JSON(t *testing.T) {
+	buffer := captureEvents(t)
+
+	err := ProgressSpinner(context.Background(), "Deploying service: web", "Service deployed: web", []func() error{
+		func() error { return nil },
+	})
+	require.NoError(t, err)
+
+	err = ProgressSpinner(context.Background(), "Starting proxy", "Proxy started", []func() error{
+		func() error { return errors.New("port 443 is in use") },
+	})
+	require.Error(t, err)
+
+	Emit(Event{Type: EventServiceUnchanged, Service: "web"})
+	Success("Deployment completed successfully.")
+
+	events := decodeEvents(t, buffer)
+	require.Len(t, events, 6)
+
+	assert.Equal(t, EventStepStarted, events[0].Type)
+	assert.Equal(t, "Deploying service: web", events[0].Step)
+	assert.Equal(t, EventStepFinished, events[1].Type)
+	assert.NotNil(t, events[1].Duration)
+	assert.Equal(t, EventStepFailed, events[3].Type)
+	assert.Equal(t, "port 443 is in use", events[3].Error)
+	assert.Equal(t, EventServiceUnchanged, events[4].Type)
+	assert.Equal(t, "web", events[4].Service)
+	assert.Equal(t, "success", events[5].Type)
+	assert.Equal(t, "Deployment completed successfully.", events[5].Message)
+	assert.False(t, events[5].Time.IsZero())
+}
@@ -0,0 +1,66 @@
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EventLog is the type of the events carrying lines of command output, such as
+// a build log, in JSON mode.
+const EventLog = "log"
+
+// LineWriter returns a writer that prints each line written to it prefixed with
+// the service that produced it, so the output of commands running side by side
+// stays readable. A partial line is held until it's completed or the writer is
+// closed. In JSON mode each line is emitted as a log event for the service.
+func LineWriter(service string) io.WriteCloser {
+	return &lineWriter{service: service}
+}
+
+type lineWriter struct {
+	service string
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.print(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	if len(w.partial) > 0 {
+		w.print(string(w.partial))
+		w.partial = nil
+	}
+
+	return nil
+}
+
+func (w *lineWriter) print(line string) {
+	line = strings.TrimRight(line, "\r")
+
+	if mode == OutputJSON {
+		Emit(Event{Type: EventLog, Service: w.service, Message: line})
+		return
+	}
+
+	prefix := w.service + " |"
+	if mode == OutputText {
+		prefix = infoColor.Sprint(prefix)
+	}
+
+	outLock.Lock()
+	defer outLock.Unlock()
+	_, _ = fmt.Fprintf(out, "%s %s\n", prefix, line)
+}
@@ -0,0 +1,40 @@
+package console
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	previousMode, previousOut := mode, out
+	out = &buffer
+	require.NoError(t, SetOutput(OutputPlain))
+	t.Cleanup(func() { mode, out = previousMode, previousOut })
+
+	w := LineWriter("web")
+	_, _ = io.WriteString(w, "#1 [1/2] FROM alpine\n#2 [2/2] RUN ")
+	_, _ = io.WriteString(w, "make\r\nerror: make failed")
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "web | #1 [1/2] FROM alpine\nweb | #2 [2/2] RUN make\nweb | error: make failed\n", buffer.String())
+}
+
+func TestLineWriter_JSON(t *testing.T) {
+	buffer := captureEvents(t)
+
+	w := LineWriter("web")
+	_, _ = io.WriteString(w, "step 1\nstep 2\n")
+	require.NoError(t, w.Close())
+
+	events := decodeEvents(t, buffer)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventLog, events[0].Type)
+	assert.Equal(t, "web", events[0].Service)
+	assert.Equal(t, "step 1", events[0].Message)
+	assert.Equal(t, "step 2", events[1].Message)
+}
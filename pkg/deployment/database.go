@@ -0,0 +1,300 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+)
+
+// Database engines recognized from the image of a dependency.
+const (
+	DatabasePostgres = "postgres"
+	DatabaseMySQL    = "mysql"
+	DatabaseMariaDB  = "mariadb"
+	DatabaseRedis    = "redis"
+	DatabaseMongo    = "mongo"
+)
+
+// redisDumpPath is where redis-cli writes the snapshot inside the container
+// before it's streamed back.
+const redisDumpPath = "/tmp/ftl-dump.rdb"
+
+// mongoAuthScript runs the Mongo tool given as its arguments with the root
+// password from the container's environment, passed in a config file only the
+// tool can read and removed afterwards.
+const mongoAuthScript = `umask 077 && f=/tmp/ftl-mongo-$$.yaml && ` +
+	`printf 'password: "%s"\n' "$(printf '%s' "$MONGO_INITDB_ROOT_PASSWORD" | sed 's/[\\"]/\\&/g')" > "$f" && ` +
+	`"$@" --config "$f"; status=$?; rm -f "$f"; exit $status`
+
+// Database describes how the database in a dependency is dumped and restored
+// with its own tools, which gives a consistent copy of a live database unlike a
+// volume backup.
+type Database struct {
+	Engine string
+	// Extension is the file extension of a dump, including the dot.
+	Extension string
+
+	// secrets maps the variables the tools read credentials from to the variables
+	// of the container that hold them. They're set by a shell inside the
+	// container, so no password shows up in a command line.
+	secrets map[string]string
+	dump    []string
+	restore []string
+}
+
+// DatabaseEngine returns the engine of the image, or "" when it isn't a database
+// ftl knows how to dump.
+func DatabaseEngine(image string) string {
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	name = path.Base(name)
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+
+	switch name {
+	case "postgres", "postgis":
+		return DatabasePostgres
+	case "mysql":
+		return DatabaseMySQL
+	case "mariadb":
+		return DatabaseMariaDB
+	case "redis":
+		return DatabaseRedis
+	case "mongo":
+		return DatabaseMongo
+	}
+
+	return ""
+}
+
+// NewDatabase returns the dump and restore commands for the dependency, using the
+// credentials from its env. It fails when the image isn't recognized.
+func NewDatabase(dependency *config.Dependency) (*Database, error) {
+	env := dependency.EnvVars
+
+	switch engine := DatabaseEngine(dependency.Image); engine {
+	case DatabasePostgres:
+		user := valueOr(env["POSTGRES_USER"], "postgres")
+		db := valueOr(env["POSTGRES_DB"], user)
+		return &Database{
+			Engine:    engine,
+			Extension: ".dump",
+			secrets:   secretFrom(env, "PGPASSWORD", "POSTGRES_PASSWORD"),
+			dump:      []string{"pg_dump", "-U", user, "-d", db, "--format=custom"},
+			restore:   []string{"pg_restore", "-U", user, "-d", db, "--clean", "--if-exists", "--no-owner"},
+		}, nil
+
+	case DatabaseMySQL, DatabaseMariaDB:
+		dumpTool, client := "mysqldump", "mysql"
+		prefixes := []string{"MYSQL_"}
+		if engine == DatabaseMariaDB {
+			dumpTool, client = "mariadb-dump", "mariadb"
+			prefixes = []string{"MARIADB_", "MYSQL_"}
+		}
+
+		// lookup returns the first variable set for key and its value.
+		lookup := func(key string) (string, string) {
+			for _, prefix := range prefixes {
+				if value := env[prefix+key]; value != "" {
+					return prefix + key, value
+				}
+			}
+			return "", ""
+		}
+
+		user := "root"
+		passwordVar, _ := lookup("ROOT_PASSWORD")
+		if _, name := lookup("USER"); passwordVar == "" && name != "" {
+			user = name
+			passwordVar, _ = lookup("PASSWORD")
+		}
+
+		dump := []string{dumpTool, "-u", user, "--single-transaction", "--routines", "--triggers"}
+		if _, db := lookup("DATABASE"); db != "" {
+			dump = append(dump, "--databases", db)
+		} else {
+			dump = append(dump, "--all-databases")
+		}
+
+		return &Database{
+			Engine:    engine,
+			Extension: ".sql",
+			secrets:   secretFrom(env, "MYSQL_PWD", passwordVar),
+			dump:      dump,
+			restore:   []string{client, "-u", user},
+		}, nil
+
+	case DatabaseRedis:
+		// A snapshot can't be loaded into a running server, so RestoreDatabase
+		// replaces the dump file instead of running a restore command.
+		return &Database{
+			Engine:    engine,
+			Extension: ".rdb",
+			secrets:   secretFrom(env, "REDISCLI_AUTH", "REDIS_PASSWORD"),
+			dump: []string{"sh", "-c", "redis-cli --rdb " + redisDumpPath + " >/dev/null && cat " + redisDumpPath +
+				" && rm -f " + redisDumpPath},
+		}, nil
+
+	case DatabaseMongo:
+		dump := []string{"mongodump", "--archive", "--gzip"}
+		restore := []string{"mongorestore", "--archive", "--gzip", "--drop"}
+		if user := env["MONGO_INITDB_ROOT_USERNAME"]; user != "" {
+			// The Mongo tools only take a password as an argument or from a config
+			// file, so it's written to a private file for the run.
+			auth := []string{"--username", user, "--authenticationDatabase", "admin"}
+			dump = append([]string{"sh", "-c", mongoAuthScript, "sh"}, append(dump, auth...)...)
+			restore = append([]string{"sh", "-c", mongoAuthScript, "sh"}, append(restore, auth...)...)
+		}
+
+		return &Database{
+			Engine:    engine,
+			Extension: ".archive.gz",
+			dump:      dump,
+			restore:   restore,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("dependency %s: image %s is not a database ftl can dump; supported are postgres, mysql, mariadb, redis and mongo",
+		dependency.Name, dependency.Image)
+}
+
+// DumpDatabase writes a dump of the database in the dependency to w, taken with
+// the database's own tools inside the running container.
+func (d *Deployment) DumpDatabase(ctx context.Context, dependency *config.Dependency, w io.Writer) error {
+	db, err := NewDatabase(dependency)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkRunning(ctx, dependency.Name); err != nil {
+		return err
+	}
+
+	if err := d.executor.StreamCommand(ctx, nil, w, "docker", db.execArgs(dependency.Name, false, db.dump)...); err != nil {
+		return fmt.Errorf("failed to dump %s: %w", dependency.Name, err)
+	}
+
+	return nil
+}
+
+// RestoreDatabase loads a dump taken by DumpDatabase into the dependency. Existing
+// objects in the dump are replaced; others are left alone, except for Redis,
+// whose whole dataset is replaced by restarting it on the dump. The deploy lock
+// is held throughout.
+func (d *Deployment) RestoreDatabase(ctx context.Context, project string, dependency *config.Dependency, r io.Reader) error {
+	db, err := NewDatabase(dependency)
+	if err != nil {
+		return err
+	}
+
+	if err := d.AcquireLock(ctx, project, d.LockWait); err != nil {
+		return fmt.Errorf("failed to acquire deploy lock: %w", err)
+	}
+	defer d.releaseLock(ctx, project)
+
+	if err := d.checkRunning(ctx, dependency.Name); err != nil {
+		return err
+	}
+
+	if db.Engine == DatabaseRedis {
+		return d.restoreRedis(ctx, dependency.Name, r)
+	}
+
+	if err := d.executor.StreamCommand(ctx, r, nil, "docker", db.execArgs(dependency.Name, true, db.restore)...); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", dependency.Name, err)
+	}
+
+	return nil
+}
+
+// restoreRedis uploads the snapshot next to the server's dump file, stops the
+// server so it can't overwrite the dump on shutdown, moves the snapshot in place
+// and starts the server again to load it. The snapshot is expected in /data, the
+// data directory of the official image.
+func (d *Deployment) restoreRedis(ctx context.Context, container string, r io.Reader) error {
+	if err := d.executor.StreamCommand(ctx, r, nil, "docker", "exec", "-i", container,
+		"sh", "-c", "cat > /data/dump.rdb.ftl"); err != nil {
+		return fmt.Errorf("failed to upload snapshot to %s: %w", container, err)
+	}
+
+	// Once stopped, the server has to be started again even if the restore is
+	// cancelled.
+	ctx = context.WithoutCancel(ctx)
+
+	if _, err := d.runCommand(ctx, "docker", "stop", container); err != nil {
+		return fmt.Errorf("failed to stop %s: %w", container, err)
+	}
+
+	_, moveErr := d.runCommand(ctx, "docker", "run", "--rm", "--volumes-from", container, volumeHelperImage,
+		"mv", "/data/dump.rdb.ftl", "/data/dump.rdb")
+
+	if _, err := d.runCommand(ctx, "docker", "start", container); err != nil {
+		console.Warning(fmt.Sprintf("Failed to start %s: %v", container, err))
+	}
+
+	if moveErr != nil {
+		return fmt.Errorf("failed to replace the dump of %s: %w", container, moveErr)
+	}
+
+	return nil
+}
+
+func (d *Deployment) checkRunning(ctx context.Context, container string) error {
+	info, err := d.inspectContainer(ctx, container)
+	if err != nil {
+		return err
+	}
+	if info == nil || !info.State.Running {
+		return fmt.Errorf("dependency %s is not running", container)
+	}
+
+	return nil
+}
+
+// execArgs returns the arguments to docker that run command in the container
+// with the database's credentials.
+func (db *Database) execArgs(container string, stdin bool, command []string) []string {
+	args := []string{"exec"}
+	if stdin {
+		args = append(args, "-i")
+	}
+	args = append(args, container)
+
+	if len(db.secrets) == 0 {
+		return append(args, command...)
+	}
+
+	var exports []string
+	for _, key := range sortedKeys(db.secrets) {
+		exports = append(exports, fmt.Sprintf(`export %s="$%s"`, key, db.secrets[key]))
+	}
+	args = append(args, "sh", "-c", strings.Join(exports, "; ")+`; exec "$@"`, "sh")
+
+	return append(args, command...)
+}
+
+// secretFrom returns the secret that sets key from the container variable name,
+// or nil when the dependency doesn't set that variable.
+func secretFrom(env map[string]string, key, name string) map[string]string {
+	if env[name] == "" {
+		return nil
+	}
+
+	return map[string]string{key: name}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
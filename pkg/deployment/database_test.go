@@ -0,0 +1,142 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestDatabaseEngine(t *testing.T) {
+	tests := map[string]string{
+		"postgres":                          DatabasePostgres,
+		"postgres:16-alpine":                DatabasePostgres,
+		"postgis/postgis:16-3.4":            DatabasePostgres,
+		"registry.example.com:5000/mysql:8": DatabaseMySQL,
+		"mariadb:11":                        DatabaseMariaDB,
+		"redis@sha256:abcdef":               DatabaseRedis,
+		"mongo:7":                           DatabaseMongo,
+		"my-app:latest":                     "",
+		"postgres-exporter:latest":          "",
+	}
+
+	for image, expected := range tests {
+		assert.Equal(t, expected, DatabaseEngine(image), image)
+	}
+}
+
+func TestNewDatabase(t *testing.T) {
+	tests := []struct {
+		name       string
+		dependency config.Dependency
+		expected   []string
+		restore    []string
+	}{
+		{
+			name: "postgres",
+			dependency: config.Dependency{Name: "db", Image: "postgres:16", EnvVars: map[string]string{
+				"POSTGRES_USER": "app", "POSTGRES_PASSWORD": "pa$$word", "POSTGRES_DB": "shop",
+			}},
+			expected: []string{"exec", "db", "sh", "-c", `export PGPASSWORD="$POSTGRES_PASSWORD"; exec "$@"`, "sh",
+				"pg_dump", "-U", "app", "-d", "shop", "--format=custom"},
+			restore: []string{"exec", "-i", "db", "sh", "-c", `export PGPASSWORD="$POSTGRES_PASSWORD"; exec "$@"`, "sh",
+				"pg_restore", "-U", "app", "-d", "shop", "--clean", "--if-exists", "--no-owner"},
+		},
+		{
+			name:       "postgres defaults",
+			dependency: config.Dependency{Name: "db", Image: "postgres:16"},
+			expected:   []string{"exec", "db", "pg_dump", "-U", "postgres", "-d", "postgres", "--format=custom"},
+			restore:    []string{"exec", "-i", "db", "pg_restore", "-U", "postgres", "-d", "postgres", "--clean", "--if-exists", "--no-owner"},
+		},
+		{
+			name: "mysql root",
+			dependency: config.Dependency{Name: "db", Image: "mysql:8", EnvVars: map[string]string{
+				"MYSQL_ROOT_PASSWORD": "secret", "MYSQL_DATABASE": "shop",
+			}},
+			expected: []string{"exec", "db", "sh", "-c", `export MYSQL_PWD="$MYSQL_ROOT_PASSWORD"; exec "$@"`, "sh",
+				"mysqldump", "-u", "root", "--single-transaction", "--routines", "--triggers", "--databases", "shop"},
+			restore: []string{"exec", "-i", "db", "sh", "-c", `export MYSQL_PWD="$MYSQL_ROOT_PASSWORD"; exec "$@"`, "sh", "mysql", "-u", "root"},
+		},
+		{
+			name: "mariadb user",
+			dependency: config.Dependency{Name: "db", Image: "mariadb:11", EnvVars: map[string]string{
+				"MARIADB_USER": "app", "MARIADB_PASSWORD": "secret",
+			}},
+			expected: []string{"exec", "db", "sh", "-c", `export MYSQL_PWD="$MARIADB_PASSWORD"; exec "$@"`, "sh",
+				"mariadb-dump", "-u", "app", "--single-transaction", "--routines", "--triggers", "--all-databases"},
+			restore: []string{"exec", "-i", "db", "sh", "-c", `export MYSQL_PWD="$MARIADB_PASSWORD"; exec "$@"`, "sh", "mariadb", "-u", "app"},
+		},
+		{
+			name:       "redis",
+			dependency: config.Dependency{Name: "cache", Image: "redis:7", EnvVars: map[string]string{"REDIS_PASSWORD": "secret"}},
+			expected: []string{"exec", "cache", "sh", "-c", `export REDISCLI_AUTH="$REDIS_PASSWORD"; exec "$@"`, "sh",
+				"sh", "-c", "redis-cli --rdb /tmp/ftl-dump.rdb >/dev/null && cat /tmp/ftl-dump.rdb && rm -f /tmp/ftl-dump.rdb"},
+		},
+		{
+			name: "mongo",
+			dependency: config.Dependency{Name: "docs", Image: "mongo:7", EnvVars: map[string]string{
+				"MONGO_INITDB_ROOT_USERNAME": "root", "MONGO_INITDB_ROOT_PASSWORD": "secret",
+			}},
+			expected: []string{"exec", "docs", "sh", "-c", mongoAuthScript, "sh", "mongodump", "--archive", "--gzip",
+				"--username", "root", "--authenticationDatabase", "admin"},
+			restore: []string{"exec", "-i", "docs", "sh", "-c", mongoAuthScript, "sh", "mongorestore", "--archive", "--gzip", "--drop",
+				"--username", "root", "--authenticationDatabase", "admin"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewDatabase(&tt.dependency)
+			require.NoError(t, err)
+
+			dump := db.execArgs(tt.dependency.Name, false, db.dump)
+			restore := db.execArgs(tt.dependency.Name, true, db.restore)
+			assert.Equal(t, tt.expected, dump)
+			if tt.restore != nil {
+				assert.Equal(t, tt.restore, restore)
+			}
+
+			for key, value := range tt.dependency.EnvVars {
+				if strings.HasSuffix(key, "PASSWORD") {
+					assert.NotContains(t, strings.Join(append(dump, restore...), " "), value, "passwords stay out of the command line")
+				}
+			}
+		})
+	}
+
+	_, err := NewDatabase(&config.Dependency{Name: "search", Image: "elasticsearch:8"})
+	assert.EqualError(t, err, "dependency search: image elasticsearch:8 is not a database ftl can dump; "+
+		"supported are postgres, mysql, mariadb, redis and mongo")
+}
+
+func TestDumpDatabase(t *testing.T) {
+	stub := &dockerStub{containers: map[string]map[string][]string{"db": {"my-project": {"db"}}}}
+	deploy := NewDeployment(stub)
+
+	var dump bytes.Buffer
+	require.NoError(t, deploy.DumpDatabase(context.Background(), &config.Dependency{Name: "db", Image: "postgres:16"}, &dump))
+	assert.Equal(t, "archive", dump.String())
+	assert.Equal(t, []string{"docker exec db pg_dump -U postgres -d postgres --format=custom"}, stub.changes)
+
+	err := deploy.DumpDatabase(context.Background(), &config.Dependency{Name: "other", Image: "postgres:16"}, &dump)
+	assert.EqualError(t, err, "dependency other is not running")
+}
+
+func TestRestoreDatabase_Redis(t *testing.T) {
+	stub := &dockerStub{containers: map[string]map[string][]string{"cache": {"my-project": {"cache"}}}}
+	deploy := NewDeployment(stub)
+
+	require.NoError(t, deploy.RestoreDatabase(context.Background(), "my-project",
+		&config.Dependency{Name: "cache", Image: "redis:7"}, strings.NewReader("snapshot")))
+	assert.Equal(t, []string{
+		"docker exec -i cache sh -c cat > /data/dump.rdb.ftl < snapshot",
+		"docker stop cache",
+		"docker run --rm --volumes-from cache alpine:3 mv /data/dump.rdb.ftl /data/dump.rdb",
+		"docker start cache",
+	}, stub.changes)
+}
@@ -0,0 +1,107 @@
+package deployment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestStartDependency_Drift(t *testing.T) {
+	dependency := &config.Dependency{
+		Name:        "postgres",
+		Image:       "postgres:16",
+		PreRecreate: "pg_dumpall -U postgres > /backup.sql",
+	}
+
+	running := func() *dockerStub {
+		return &dockerStub{containers: map[string]map[string][]string{"postgres": {"app": {"postgres"}}}}
+	}
+
+	stub := running()
+	deploy := NewDeployment(stub)
+	require.NoError(t, deploy.startDependency(context.Background(), "app", dependency))
+	assert.Empty(t, stub.changes, "a drifted dependency is left running")
+
+	stub = running()
+	deploy = NewDeployment(stub)
+	deploy.RecreateDependencies = []string{"postgres"}
+	require.NoError(t, deploy.startDependency(context.Background(), "app", dependency))
+	require.Len(t, stub.changes, 5)
+	assert.Equal(t, []string{
+		"docker exec postgres sh -c pg_dumpall -U postgres > /backup.sql",
+		"docker stop postgres",
+		"docker rename postgres postgres_old",
+	}, stub.changes[:3])
+	assert.Contains(t, stub.changes[3], "docker run -d --name postgres ")
+	assert.Equal(t, "docker rm postgres", stub.changes[4], "the old container is removed once the new one is healthy")
+}
+
+func TestServiceDrift(t *testing.T) {
+	service := &config.Service{Name: "postgres", Image: "postgres:16"}
+	hash, err := service.Hash()
+	require.NoError(t, err)
+
+	container := &containerInfo{Image: "sha256:abc"}
+	container.Config.Labels = map[string]string{"ftl.config-hash": hash}
+
+	drift, err := serviceDrift(service, container, "sha256:abc")
+	require.NoError(t, err)
+	assert.Empty(t, drift)
+
+	drift, err = serviceDrift(service, container, "sha256:def")
+	require.NoError(t, err)
+	assert.Equal(t, "image changed", drift)
+
+	service.Memory = "1g"
+	drift, err = serviceDrift(service, container, "sha256:abc")
+	require.NoError(t, err)
+	assert.Equal(t, "config changed", drift)
+}
+
+func TestStartDependency_RecreateFailed(t *testing.T) {
+	stub := &dockerStub{
+		containers: map[string]map[string][]string{"postgres": {"app": {"postgres"}}},
+		failures:   map[string]error{"docker run -d --name postgres ": errors.New("port is already allocated")},
+	}
+	deploy := NewDeployment(stub)
+	deploy.RecreateDependencies = []string{"postgres"}
+
+	err := deploy.startDependency(context.Background(), "app", &config.Dependency{Name: "postgres", Image: "postgres:16"})
+	require.ErrorContains(t, err, "old container restored")
+	require.Len(t, stub.changes, 6)
+	assert.Equal(t, []string{"docker stop postgres", "docker rename postgres postgres_old"}, stub.changes[:2])
+	assert.Equal(t, []string{
+		"docker rm -f postgres",
+		"docker rename postgres postgres",
+		"docker start postgres",
+	}, stub.changes[3:])
+}
+
+func TestDependencyDrift(t *testing.T) {
+	dependency := &config.Dependency{Name: "postgres", Image: "postgres:16", Runtime: config.Runtime{Memory: "1g"}}
+	hash, err := dependency.Hash()
+	require.NoError(t, err)
+
+	container := &containerInfo{Image: "sha256:abc"}
+	container.Config.Labels = map[string]string{dependencyHashLabel: hash, "ftl.config-hash": "outdated"}
+
+	drift, err := dependencyDrift(dependency, container, "sha256:abc", hash)
+	require.NoError(t, err)
+	assert.Empty(t, drift, "only the dependency hash is compared")
+
+	drift, err = dependencyDrift(dependency, container, "sha256:def", hash)
+	require.NoError(t, err)
+	assert.Equal(t, "image changed", drift)
+
+	dependency.Memory = "2g"
+	changed, err := dependency.Hash()
+	require.NoError(t, err)
+	drift, err = dependencyDrift(dependency, container, "sha256:abc", changed)
+	require.NoError(t, err)
+	assert.Equal(t, "config changed", drift)
+}
@@ -2,48 +2,95 @@ package deployment
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"github.com/yarlson/ftl/pkg/console"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
-	"unicode"
 
 	"github.com/yarlson/ftl/pkg/config"
-	"github.com/yarlson/ftl/pkg/proxy"
+	"github.com/yarlson/ftl/pkg/console"
+	"github.com/yarlson/ftl/pkg/multierror"
 )
 
 const (
 	newContainerSuffix = "_new"
+
+	// oldContainerSuffix names the stopped container kept while its replacement
+	// is started by recreateService.
+	oldContainerSuffix = "_old"
+
+	// dependencyHashLabel holds the hash of the dependency config a container
+	// was started from.
+	dependencyHashLabel = "ftl.dependency-hash"
+
+	// publishedHashLabel holds the hash of the settings a container with
+	// published ports can't change without being recreated.
+	publishedHashLabel = "ftl.published-hash"
 )
 
 type Executor interface {
 	RunCommand(ctx context.Context, command string, args ...string) (io.Reader, error)
 	CopyFile(ctx context.Context, from, to string) error
+	StreamCommand(ctx context.Context, in io.Reader, out io.Writer, command string, args ...string) error
 }
 
 type Deployment struct {
 	executor Executor
+
+	// LockWait is how long Deploy waits for another deploy of the same project
+	// to release the lock before giving up.
+	LockWait time.Duration
+
+	// Services limits Deploy to the named services and dependencies. Static
+	// sites and jobs are skipped when it's set. Empty means everything is deployed.
+	Services []string
+
+	// RecreateDependencies lists the dependencies whose container is replaced
+	// even though they hold state. Other dependencies that drifted from the
+	// config are left running.
+	RecreateDependencies []string
+
+	// SkipDependencies and SkipProxy leave the dependencies and the proxy as
+	// they are.
+	SkipDependencies bool
+	SkipProxy        bool
+
+	// Revision is the git revision being deployed. It's recorded with the release.
+	Revision string
+
+	heartbeatsMu sync.Mutex
+	heartbeats   map[string]*heartbeat // project -> heartbeat of its held lock
 }
 
 func NewDeployment(executor Executor) *Deployment {
 	return &Deployment{executor: executor}
 }
 
-func (d *Deployment) Deploy(project string, cfg *config.Config) error {
-	if err := console.ProgressSpinner(context.Background(), "Creating network", "Network created", []func() error{
-		func() error { return d.createNetwork(project) },
+// Deploy brings the project on the server in line with cfg. Cancelling ctx stops
+// the deploy after rolling back the step in progress; see UpdateService.
+func (d *Deployment) Deploy(ctx context.Context, project string, cfg *config.Config) error {
+	if err := d.AcquireLock(ctx, project, d.LockWait); err != nil {
+		return fmt.Errorf("failed to acquire deploy lock: %w", err)
+	}
+	defer d.releaseLock(ctx, project)
+
+	if err := console.ProgressSpinner(ctx, "Creating network", "Network created", []func() error{
+		func() error { return d.createNetwork(ctx, project) },
 	}); err != nil {
 		return fmt.Errorf("failed to create network: %w", err)
 	}
 
-	if err := console.ProgressSpinner(context.Background(), "Creating volumes", "Volumes created", []func() error{
+	if err := console.ProgressSpinner(ctx, "Creating volumes", "Volumes created", []func() error{
 		func() error {
 			for _, volume := range cfg.Volumes {
-				if err := d.createVolume(project, volume); err != nil {
+				if err := d.createVolume(ctx, project, volume); err != nil {
 					return fmt.Errorf("failed to create volume: %w", err)
 				}
 			}
@@ -54,144 +101,380 @@ func (d *Deployment) Deploy(project string, cfg *config.Config) error {
 	}
 
 	for _, dependency := range cfg.Dependencies {
-		if err := console.ProgressSpinner(context.Background(),
+		if d.SkipDependencies || !(d.selected(dependency.Name) || contains(d.RecreateDependencies, dependency.Name)) {
+			continue
+		}
+
+		if err := console.ProgressSpinner(ctx,
 			fmt.Sprintf("Creating dependency %s", dependency.Name),
 			fmt.Sprintf("Dependency %s created", dependency.Name),
 			[]func() error{
-				func() error { return d.startDependency(project, &dependency) },
+				func() error { return d.startDependency(ctx, project, &dependency) },
 			}); err != nil {
 			return fmt.Errorf("failed to create dependency %s: %w", dependency.Name, err)
 		}
 	}
 
+	// Services and static sites don't depend on each other, so a failure is
+	// recorded and the remaining ones are still deployed.
+	var errs multierror.Error
+
 	for _, service := range cfg.Services {
-		if err := console.ProgressSpinner(context.Background(),
+		if !d.selected(service.Name) {
+			continue
+		}
+
+		if err := console.ProgressSpinner(ctx,
 			fmt.Sprintf("Deploying service: %s", service.Name),
 			fmt.Sprintf("Service deployed: %s", service.Name),
 			[]func() error{
-				func() error { return d.deployService(project, &service) },
+				func() error { return d.deployService(ctx, project, &service) },
 			}); err != nil {
-			return fmt.Errorf("failed to deploy service %s: %w", service.Name, err)
+			errs.Add("service "+service.Name, err)
+			if ctx.Err() != nil {
+				return errs.ErrorOrNil()
+			}
 		}
 	}
 
-	if err := console.ProgressSpinner(context.Background(), "Starting proxy", "Proxy started", []func() error{
-		func() error { return d.StartProxy(cfg.Project.Name, cfg) },
-	}); err != nil {
-		return fmt.Errorf("failed to start proxy: %w", err)
+	for _, static := range cfg.Static {
+		if len(d.Services) > 0 {
+			break
+		}
+
+		if err := console.ProgressSpinner(ctx,
+			fmt.Sprintf("Syncing static site: %s", static.Name),
+			fmt.Sprintf("Static site synced: %s", static.Name),
+			[]func() error{
+				func() error {
+					_, err := d.SyncStatic(ctx, project, &static)
+					return err
+				},
+			}); err != nil {
+			errs.Add("static site "+static.Name, err)
+			if ctx.Err() != nil {
+				return errs.ErrorOrNil()
+			}
+		}
 	}
 
-	return nil
+	if len(d.Services) == 0 {
+		if err := console.ProgressSpinner(ctx, "Syncing jobs", "Jobs synced", []func() error{
+			func() error {
+				return d.SyncJobs(ctx, project, cfg)
+			},
+		}); err != nil {
+			errs.Add("jobs", err)
+			if ctx.Err() != nil {
+				return errs.ErrorOrNil()
+			}
+		}
+	}
+
+	// The proxy configuration is rendered from the whole config, so deploying a
+	// subset only reloads the proxy when routes actually changed.
+	if cfg.Proxy.IsEnabled() && !d.SkipProxy {
+		if err := console.ProgressSpinner(ctx, "Starting proxy", "Proxy started", []func() error{
+			func() error { return d.StartProxy(ctx, cfg.Project.Name, cfg) },
+		}); err != nil {
+			errs.Add("proxy", err)
+		}
+	}
+
+	// Only a deploy that succeeded in full is recorded as a release.
+	if len(errs.Failures) == 0 {
+		if err := d.recordRelease(ctx, project, cfg); err != nil {
+			console.Warning(fmt.Sprintf("Failed to record the release: %v", err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// selected reports whether Services lets the named service or dependency deploy.
+func (d *Deployment) selected(name string) bool {
+	return len(d.Services) == 0 || contains(d.Services, name)
 }
 
-func (d *Deployment) StartProxy(project string, cfg *config.Config) error {
-	projectPath, err := d.prepareProjectFolder(project)
+// startDependency installs a dependency that isn't running yet. Dependencies hold
+// state, so one that drifted from the config is left running and reported, unless
+// it's listed in RecreateDependencies. It's then stopped before the new container
+// starts, so two instances never share a volume.
+func (d *Deployment) startDependency(ctx context.Context, project string, dependency *config.Dependency) error {
+	imageHash, err := d.pullImage(ctx, dependency.Image)
 	if err != nil {
-		return fmt.Errorf("failed to prepare project folder: %w", err)
+		return fmt.Errorf("failed to pull image for %s: %v", dependency.Image, err)
 	}
 
-	configPath, err := d.prepareNginxConfig(cfg, projectPath)
+	hash, err := dependency.Hash()
 	if err != nil {
-		return fmt.Errorf("failed to prepare nginx config: %w", err)
+		return fmt.Errorf("failed to generate config hash: %w", err)
 	}
 
-	service := &config.Service{
-		Name:  "proxy",
-		Image: "yarlson/zero-nginx:latest",
-		Port:  80,
-		Volumes: []string{
-			projectPath + "/:/etc/nginx/ssl",
-			configPath + ":/etc/nginx/conf.d",
-		},
-		EnvVars: map[string]string{
-			"DOMAIN": cfg.Project.Domain,
-			"EMAIL":  cfg.Project.Email,
-		},
-		Forwards: []string{
-			"80:80",
-			"443:443",
-		},
-		HealthCheck: &config.HealthCheck{
-			Path:     "/",
-			Interval: time.Second,
-			Timeout:  time.Second,
-			Retries:  30,
-		},
+	service := dependencyService(dependency)
+	service.Labels = map[string]string{dependencyHashLabel: hash}
+	for key, value := range dependency.Labels {
+		service.Labels[key] = value
 	}
 
-	if err := d.deployService(project, service); err != nil {
-		return fmt.Errorf("failed to deploy service %s: %w", service.Name, err)
+	if err := d.reconcileService(ctx, project, service); err != nil {
+		return fmt.Errorf("failed to recover dependency %s: %w", service.Name, err)
 	}
 
-	return nil
-}
+	containerInfo, err := d.getContainerInfo(ctx, service.Name, project)
+	if err != nil {
+		if err := d.InstallService(ctx, project, service); err != nil {
+			return fmt.Errorf("failed to start container for %s: %v", dependency.Image, err)
+		}
 
-func (d *Deployment) startDependency(project string, dependency *config.Dependency) error {
-	if _, err := d.pullImage(dependency.Image); err != nil {
-		return fmt.Errorf("failed to pull image for %s: %v", dependency.Image, err)
+		console.Emit(console.Event{Type: console.EventServiceInstalled, Service: service.Name})
+		return nil
 	}
 
-	service := &config.Service{
-		Name:    dependency.Name,
-		Image:   dependency.Image,
-		Volumes: dependency.Volumes,
-		EnvVars: dependency.EnvVars,
+	drift, err := dependencyDrift(dependency, containerInfo, imageHash, hash)
+	if err != nil {
+		return err
 	}
-	if err := d.deployService(project, service); err != nil {
-		return fmt.Errorf("failed to start container for %s: %v", dependency.Image, err)
+
+	if !contains(d.RecreateDependencies, dependency.Name) {
+		if drift == "" {
+			console.Emit(console.Event{Type: console.EventServiceUnchanged, Service: service.Name})
+			return nil
+		}
+
+		console.Warning(fmt.Sprintf("Dependency %s differs from ftl.yaml (%s) and was left running; deploy with --recreate-dependency %s to replace it", service.Name, drift, service.Name))
+		console.Emit(console.Event{Type: console.EventDependencyDrifted, Service: service.Name, Message: drift})
+		return nil
+	}
+
+	if dependency.PreRecreate != "" {
+		if _, err := d.runCommand(ctx, "docker", "exec", containerInfo.ID, "sh", "-c", dependency.PreRecreate); err != nil {
+			return fmt.Errorf("pre_recreate hook of %s failed, dependency left running: %w", service.Name, err)
+		}
 	}
 
+	if err := d.recreateService(ctx, project, service); err != nil {
+		return fmt.Errorf("failed to recreate dependency %s: %w", service.Name, err)
+	}
+
+	console.Emit(console.Event{Type: console.EventServiceUpdated, Service: service.Name, Message: "recreated"})
 	return nil
 }
 
-func (d *Deployment) InstallService(project string, service *config.Service) error {
-	if _, err := d.pullImage(service.Image); err != nil {
+func (d *Deployment) InstallService(ctx context.Context, project string, service *config.Service) error {
+	if err := d.ensureImage(ctx, service); err != nil {
 		return fmt.Errorf("failed to pull image for %s: %v", service.Image, err)
 	}
 
-	if err := d.startContainer(project, service, ""); err != nil {
-		return fmt.Errorf("failed to start container for %s: %v", service.Image, err)
-	}
-
 	svcName := service.Name
 
-	if err := d.performHealthChecks(svcName, service.HealthCheck); err != nil {
+	if err := d.startContainer(ctx, project, service, ""); err != nil {
+		d.rollbackContainer(ctx, svcName)
+		return fmt.Errorf("failed to start container for %s: %w", service.Image, err)
+	}
+
+	if err := d.performHealthChecks(ctx, project, svcName, service); err != nil {
+		d.rollbackContainer(ctx, svcName)
 		return fmt.Errorf("install failed for %s: container is unhealthy: %w", svcName, err)
 	}
 
 	return nil
 }
 
-func (d *Deployment) UpdateService(project string, service *config.Service) error {
+// UpdateService replaces the container of a running service without downtime: a
+// new container is started next to the old one and traffic is switched once it's
+// healthy. When ctx is cancelled before the switch, the new container is removed
+// and the old one keeps serving. Once the switch has started it is completed, as a
+// half-switched service is worse than either side of it. Workers take no traffic,
+// so their old container is just stopped once the new one is healthy.
+func (d *Deployment) UpdateService(ctx context.Context, project string, service *config.Service) error {
 	svcName := service.Name
 
-	if _, err := d.pullImage(service.Image); err != nil {
+	if len(service.Forwards) > 0 {
+		return d.updatePublishedService(ctx, project, service)
+	}
+
+	var oldContID string
+	if service.IsWorker() {
+		// The new container of a worker carries the service alias from the
+		// start, so the old one is looked up first.
+		id, err := d.getContainerID(ctx, project, svcName)
+		if err != nil {
+			return fmt.Errorf("failed to get old container ID for %s: %v", svcName, err)
+		}
+		oldContID = id
+	}
+
+	if err := d.ensureImage(ctx, service); err != nil {
 		return fmt.Errorf("failed to pull new image for %s: %v", svcName, err)
 	}
 
-	if err := d.startContainer(project, service, newContainerSuffix); err != nil {
-		return fmt.Errorf("failed to start new container for %s: %v", svcName, err)
+	if err := d.startContainer(ctx, project, service, newContainerSuffix); err != nil {
+		d.rollbackContainer(ctx, svcName+newContainerSuffix)
+		return fmt.Errorf("failed to start new container for %s: %w", svcName, err)
 	}
 
-	if err := d.performHealthChecks(svcName+newContainerSuffix, service.HealthCheck); err != nil {
-		if _, err := d.runCommand(context.Background(), "docker", "rm", "-f", svcName+newContainerSuffix); err != nil {
+	if err := d.performHealthChecks(ctx, project, svcName+newContainerSuffix, service); err != nil {
+		if _, err := d.runCommand(context.WithoutCancel(ctx), "docker", "rm", "-f", svcName+newContainerSuffix); err != nil {
 			return fmt.Errorf("update failed for %s: new container is unhealthy and cleanup failed: %v", svcName, err)
 		}
 		return fmt.Errorf("update failed for %s: new container is unhealthy: %w", svcName, err)
 	}
 
-	oldContID, err := d.switchTraffic(project, svcName)
-	if err != nil {
-		return fmt.Errorf("failed to switch traffic for %s: %v", svcName, err)
+	ctx = context.WithoutCancel(ctx)
+
+	if !service.IsWorker() {
+		id, err := d.switchTraffic(ctx, project, svcName)
+		if err != nil {
+			return fmt.Errorf("failed to switch traffic for %s: %v", svcName, err)
+		}
+		oldContID = id
 	}
 
-	if err := d.cleanup(oldContID, svcName); err != nil {
+	if err := d.cleanup(ctx, oldContID, svcName); err != nil {
 		return fmt.Errorf("failed to cleanup for %s: %v", svcName, err)
 	}
 
 	return nil
 }
 
+// updatePublishedService updates a service that publishes host ports, such as the
+// proxy. Its container can't run next to a replacement, so it's only recreated
+// when its image, published ports, mounts or environment changed. Resource limits
+// are updated in the running container where Docker allows it, and a changed
+// proxy configuration is reloaded in place by StartProxy.
+func (d *Deployment) updatePublishedService(ctx context.Context, project string, service *config.Service) error {
+	container, err := d.getContainerInfo(ctx, service.Name, project)
+	if err != nil {
+		return fmt.Errorf("failed to get old container for %s: %v", service.Name, err)
+	}
+
+	imageHash, err := d.imageID(ctx, service.Image)
+	if err != nil {
+		return err
+	}
+
+	hash, err := publishedHash(service)
+	if err != nil {
+		return err
+	}
+
+	if imageHash != container.Image || container.Config.Labels[publishedHashLabel] != hash {
+		return d.recreateService(ctx, project, service)
+	}
+
+	restart := service.Restart
+	if restart == "" {
+		restart = config.DefaultRestartPolicy
+	}
+	args := []string{"update", "--restart", restart}
+	if service.Memory != "" {
+		args = append(args, "--memory", service.Memory)
+	}
+	if service.CPUs != "" {
+		args = append(args, "--cpus", service.CPUs)
+	}
+
+	// Docker refuses some changes to the limits of a running container, such as
+	// raising the memory above the swap limit it was started with.
+	if _, err := d.runCommand(ctx, "docker", append(args, container.ID)...); err != nil {
+		console.Warning(fmt.Sprintf("Failed to update %s in place, recreating it: %v", service.Name, err))
+		return d.recreateService(ctx, project, service)
+	}
+
+	return nil
+}
+
+// publishedHash hashes the settings of a service with published ports that can
+// only change by recreating its container.
+func publishedHash(service *config.Service) (string, error) {
+	forwards := append([]string(nil), service.Forwards...)
+	sort.Strings(forwards)
+
+	volumes := make([]string, len(service.Volumes))
+	for i, mount := range service.Volumes {
+		volumes[i] = mount.String()
+	}
+	sort.Strings(volumes)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"image":    service.Image,
+		"forwards": forwards,
+		"volumes":  volumes,
+		"env":      service.EnvVars,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate config hash: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// recreateService replaces the running container by stopping it before the new one
+// is started. It is used for services that publish host ports, since two containers
+// can't bind the same port at once, for dependencies, so two instances never share
+// a volume, and for the job scheduler, so no job is started twice. The old
+// container is kept as <name>_old until the new one is healthy, and is started
+// again in its place otherwise, also when ctx is cancelled during the health check.
+func (d *Deployment) recreateService(ctx context.Context, project string, service *config.Service) error {
+	svcName := service.Name
+	oldName := svcName + oldContainerSuffix
+
+	oldContID, err := d.getContainerID(ctx, project, svcName)
+	if err != nil {
+		return fmt.Errorf("failed to get old container ID for %s: %v", svcName, err)
+	}
+
+	uncancelled := context.WithoutCancel(ctx)
+
+	cmds := [][]string{
+		{"docker", "stop", oldContID},
+		{"docker", "rename", oldContID, oldName},
+	}
+
+	for _, cmd := range cmds {
+		if _, err := d.runCommand(uncancelled, cmd[0], cmd[1:]...); err != nil {
+			if _, startErr := d.runCommand(uncancelled, "docker", "start", oldContID); startErr != nil {
+				console.Warning(fmt.Sprintf("Failed to start old container of %s again: %v", svcName, startErr))
+			}
+			return fmt.Errorf("failed to execute command '%s': %v", strings.Join(cmd, " "), err)
+		}
+	}
+
+	if err := d.startContainer(uncancelled, project, service, ""); err != nil {
+		d.restoreContainer(uncancelled, svcName, oldContID)
+		return fmt.Errorf("failed to start container for %s, old container restored: %v", svcName, err)
+	}
+
+	if err := d.performHealthChecks(ctx, project, svcName, service); err != nil {
+		d.restoreContainer(uncancelled, svcName, oldContID)
+		return fmt.Errorf("recreate failed for %s: container is unhealthy, old container restored: %w", svcName, err)
+	}
+
+	if _, err := d.runCommand(uncancelled, "docker", "rm", oldContID); err != nil {
+		console.Warning(fmt.Sprintf("Failed to remove old container %s: %v", oldName, err))
+	}
+
+	return nil
+}
+
+// restoreContainer puts the old container of a failed recreate back in place of
+// the new one.
+func (d *Deployment) restoreContainer(ctx context.Context, service, oldContID string) {
+	cmds := [][]string{
+		{"docker", "rm", "-f", service},
+		{"docker", "rename", oldContID, service},
+		{"docker", "start", oldContID},
+	}
+
+	for _, cmd := range cmds {
+		if _, err := d.runCommand(ctx, cmd[0], cmd[1:]...); err != nil && cmd[1] != "rm" {
+			console.Warning(fmt.Sprintf("Failed to restore old container of %s: '%s': %v", service, strings.Join(cmd, " "), err))
+		}
+	}
+}
+
 type containerInfo struct {
 	ID     string
 	Config struct {
@@ -206,10 +489,13 @@ type containerInfo struct {
 	HostConfig struct {
 		Binds []string
 	}
+	State struct {
+		Running bool
+	}
 }
 
-func (d *Deployment) getContainerID(project, service string) (string, error) {
-	info, err := d.getContainerInfo(service, project)
+func (d *Deployment) getContainerID(ctx context.Context, project, service string) (string, error) {
+	info, err := d.getContainerInfo(ctx, service, project)
 	if err != nil {
 		return "", err
 	}
@@ -217,15 +503,15 @@ func (d *Deployment) getContainerID(project, service string) (string, error) {
 	return info.ID, err
 }
 
-func (d *Deployment) getContainerInfo(service, network string) (*containerInfo, error) {
-	output, err := d.runCommand(context.Background(), "docker", "ps", "-aq", "--filter", fmt.Sprintf("network=%s", network))
+func (d *Deployment) getContainerInfo(ctx context.Context, service, network string) (*containerInfo, error) {
+	output, err := d.runCommand(ctx, "docker", "ps", "-aq", "--filter", fmt.Sprintf("network=%s", network))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get container IDs: %w", err)
 	}
 
 	containerIDs := strings.Fields(output)
 	for _, cid := range containerIDs {
-		inspectOutput, err := d.runCommand(context.Background(), "docker", "inspect", cid)
+		inspectOutput, err := d.runCommand(ctx, "docker", "inspect", cid)
 		if err != nil {
 			continue
 		}
@@ -247,33 +533,54 @@ func (d *Deployment) getContainerInfo(service, network string) (*containerInfo,
 	return nil, fmt.Errorf("no container found with alias %s in network %s", service, network)
 }
 
-func (d *Deployment) startContainer(project string, service *config.Service, suffix string) error {
+func (d *Deployment) startContainer(ctx context.Context, project string, service *config.Service, suffix string) error {
 	svcName := service.Name
 
-	args := []string{"run", "-d", "--name", svcName + suffix, "--network", project, "--network-alias", svcName + suffix}
+	alias := svcName + suffix
+	if service.IsWorker() {
+		alias = svcName
+	}
+
+	args := []string{"run", "-d", "--name", svcName + suffix, "--network", project, "--network-alias", alias}
 
 	for key, value := range service.EnvVars {
 		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
 	}
 
-	for _, volume := range service.Volumes {
-		if unicode.IsLetter(rune(volume[0])) {
-			volume = fmt.Sprintf("%s-%s", project, volume)
+	var projectPath string
+	for _, mount := range service.Volumes {
+		if mount.IsRelative() && projectPath == "" {
+			path, err := d.projectFolder(ctx, project)
+			if err != nil {
+				return err
+			}
+			projectPath = path
 		}
-		args = append(args, "-v", volume)
+		args = append(args, "--mount", mountArg(project, projectPath, mount))
 	}
 
-	if service.HealthCheck != nil {
-		args = append(args, "--health-cmd", fmt.Sprintf("curl -sf http://localhost:%d%s || exit 1", service.Port, service.HealthCheck.Path))
-		args = append(args, "--health-interval", fmt.Sprintf("%ds", int(service.HealthCheck.Interval.Seconds())))
+	args = append(args, runtimeArgs(&service.Runtime)...)
+
+	if service.HealthCheck != nil && !service.HealthCheck.IsSidecar() {
+		args = append(args, "--health-cmd", healthCommand(service.HealthCheck, "localhost", healthCheckPort(service)))
+		args = append(args, "--health-interval", service.HealthCheck.Interval.String())
 		args = append(args, "--health-retries", fmt.Sprintf("%d", service.HealthCheck.Retries))
-		args = append(args, "--health-timeout", fmt.Sprintf("%ds", int(service.HealthCheck.Timeout.Seconds())))
+		args = append(args, "--health-timeout", service.HealthCheck.Timeout.String())
+		if service.HealthCheck.StartPeriod > 0 {
+			args = append(args, "--health-start-period", service.HealthCheck.StartPeriod.String())
+		}
 	}
 
 	if len(service.Forwards) > 0 {
 		for _, forward := range service.Forwards {
 			args = append(args, "-p", forward)
 		}
+
+		hash, err := publishedHash(service)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--label", fmt.Sprintf("%s=%s", publishedHashLabel, hash))
 	}
 
 	hash, err := service.Hash()
@@ -282,29 +589,18 @@ func (d *Deployment) startContainer(project string, service *config.Service, suf
 	}
 	args = append(args, "--label", fmt.Sprintf("ftl.config-hash=%s", hash))
 	args = append(args, service.Image)
-
-	_, err = d.runCommand(context.Background(), "docker", args...)
-	return err
-}
-
-func (d *Deployment) performHealthChecks(container string, healthCheck *config.HealthCheck) error {
-	if healthCheck == nil {
-		return nil
+	if len(service.Entrypoint) > 1 {
+		args = append(args, service.Entrypoint[1:]...)
 	}
+	args = append(args, service.Command...)
 
-	for i := 0; i < healthCheck.Retries; i++ {
-		output, err := d.runCommand(context.Background(), "docker", "inspect", "--format={{.State.Health.Status}}", container)
-		if err == nil && strings.TrimSpace(output) == "healthy" {
-			return nil
-		}
-		time.Sleep(healthCheck.Interval)
-	}
-	return fmt.Errorf("container failed to become healthy")
+	_, err = d.runCommand(ctx, "docker", args...)
+	return err
 }
 
-func (d *Deployment) switchTraffic(project, service string) (string, error) {
+func (d *Deployment) switchTraffic(ctx context.Context, project, service string) (string, error) {
 	newContainer := service + newContainerSuffix
-	oldContainer, err := d.getContainerID(project, service)
+	oldContainer, err := d.getContainerID(ctx, project, service)
 	if err != nil {
 		return "", fmt.Errorf("failed to get old container ID: %v", err)
 	}
@@ -315,7 +611,7 @@ func (d *Deployment) switchTraffic(project, service string) (string, error) {
 	}
 
 	for _, cmd := range cmds {
-		if _, err := d.runCommand(context.Background(), cmd[0], cmd[1:]...); err != nil {
+		if _, err := d.runCommand(ctx, cmd[0], cmd[1:]...); err != nil {
 			return "", fmt.Errorf("failed to execute command '%s': %v", strings.Join(cmd, " "), err)
 		}
 	}
@@ -327,7 +623,7 @@ func (d *Deployment) switchTraffic(project, service string) (string, error) {
 	}
 
 	for _, cmd := range cmds {
-		if _, err := d.runCommand(context.Background(), cmd[0], cmd[1:]...); err != nil {
+		if _, err := d.runCommand(ctx, cmd[0], cmd[1:]...); err != nil {
 			return "", fmt.Errorf("failed to execute command '%s': %v", strings.Join(cmd, " "), err)
 		}
 	}
@@ -335,7 +631,7 @@ func (d *Deployment) switchTraffic(project, service string) (string, error) {
 	return oldContainer, nil
 }
 
-func (d *Deployment) cleanup(oldContID, service string) error {
+func (d *Deployment) cleanup(ctx context.Context, oldContID, service string) error {
 	cmds := [][]string{
 		{"docker", "stop", oldContID},
 		{"docker", "rm", oldContID},
@@ -343,7 +639,7 @@ func (d *Deployment) cleanup(oldContID, service string) error {
 	}
 
 	for _, cmd := range cmds {
-		if _, err := d.runCommand(context.Background(), cmd[0], cmd[1:]...); err != nil {
+		if _, err := d.runCommand(ctx, cmd[0], cmd[1:]...); err != nil {
 			return fmt.Errorf("failed to execute command '%s': %v", strings.Join(cmd, " "), err)
 		}
 	}
@@ -351,18 +647,36 @@ func (d *Deployment) cleanup(oldContID, service string) error {
 	return nil
 }
 
-func (d *Deployment) pullImage(imageName string) (string, error) {
-	_, err := d.runCommand(context.Background(), "docker", "pull", imageName)
-	if err != nil {
-		return "", err
+// rollbackContainer removes a container whose start was interrupted by cancelling
+// ctx, so the next deploy doesn't trip over it. Other failures leave the container
+// in place for inspection.
+func (d *Deployment) rollbackContainer(ctx context.Context, name string) {
+	if ctx.Err() == nil {
+		return
 	}
 
-	output, err := d.runCommand(context.Background(), "docker", "images", "--no-trunc", "--format={{.ID}}", imageName)
+	if _, err := d.runCommand(context.WithoutCancel(ctx), "docker", "rm", "-f", name); err != nil {
+		console.Warning(fmt.Sprintf("Failed to remove interrupted container %s: %v", name, err))
+	}
+}
+
+// sleep waits for the duration or until ctx is cancelled.
+func sleep(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
+
+func (d *Deployment) pullImage(ctx context.Context, imageName string) (string, error) {
+	_, err := d.runCommand(ctx, "docker", "pull", imageName)
 	if err != nil {
 		return "", err
 	}
 
-	return strings.TrimSpace(output), nil
+	return d.imageID(ctx, imageName)
 }
 
 func (d *Deployment) runCommand(ctx context.Context, command string, args ...string) (string, error) {
@@ -379,18 +693,18 @@ func (d *Deployment) runCommand(ctx context.Context, command string, args ...str
 	return strings.TrimSpace(string(outputBytes)), nil
 }
 
-func (d *Deployment) makeProjectFolder(projectName string) error {
-	projectPath, err := d.projectFolder(projectName)
+func (d *Deployment) makeProjectFolder(ctx context.Context, projectName string) error {
+	projectPath, err := d.projectFolder(ctx, projectName)
 	if err != nil {
 		return fmt.Errorf("failed to get project folder path: %w", err)
 	}
 
-	_, err = d.runCommand(context.Background(), "mkdir", "-p", projectPath)
+	_, err = d.runCommand(ctx, "mkdir", "-p", projectPath)
 	return err
 }
 
-func (d *Deployment) projectFolder(projectName string) (string, error) {
-	homeDir, err := d.runCommand(context.Background(), "sh", "-c", "echo $HOME")
+func (d *Deployment) projectFolder(ctx context.Context, projectName string) (string, error) {
+	homeDir, err := d.runCommand(ctx, "sh", "-c", "echo $HOME")
 	if err != nil {
 		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
@@ -401,94 +715,123 @@ func (d *Deployment) projectFolder(projectName string) (string, error) {
 	return projectPath, nil
 }
 
-func (d *Deployment) prepareProjectFolder(project string) (string, error) {
-	if err := d.makeProjectFolder(project); err != nil {
+func (d *Deployment) prepareProjectFolder(ctx context.Context, project string) (string, error) {
+	if err := d.makeProjectFolder(ctx, project); err != nil {
 		return "", fmt.Errorf("failed to create project folder: %w", err)
 	}
 
-	return d.projectFolder(project)
+	return d.projectFolder(ctx, project)
 }
 
-func (d *Deployment) prepareNginxConfig(cfg *config.Config, projectPath string) (string, error) {
-	nginxConfig, err := proxy.GenerateNginxConfig(cfg)
+func (d *Deployment) copyContent(ctx context.Context, content, dst string) error {
+	tmpFile, err := os.CreateTemp("", "ftl-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to generate nginx config: %w", err)
+		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
+	defer os.Remove(tmpFile.Name())
 
-	nginxConfig = strings.TrimSpace(nginxConfig)
+	if _, err := tmpFile.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
 
-	configPath := filepath.Join(projectPath, "nginx")
-	_, err = d.runCommand(context.Background(), "mkdir", "-p", configPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create nginx config directory: %w", err)
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
 	}
 
-	tmpFile, err := os.CreateTemp("", "nginx-config-*.conf")
+	return d.executor.CopyFile(ctx, tmpFile.Name(), dst)
+}
+
+// serviceDrift describes how the running container differs from the service
+// config, or returns an empty string when it matches.
+func serviceDrift(service *config.Service, container *containerInfo, imageHash string) (string, error) {
+	if imageHash != container.Image {
+		return "image changed", nil
+	}
+
+	hash, err := service.Hash()
 	if err != nil {
-		return "", fmt.Errorf("failed to create temporary file: %w", err)
+		return "", fmt.Errorf("failed to generate config hash: %w", err)
 	}
-	defer os.Remove(tmpFile.Name())
 
-	if _, err := tmpFile.WriteString(nginxConfig); err != nil {
-		return "", fmt.Errorf("failed to write nginx config to temporary file: %w", err)
+	if container.Config.Labels["ftl.config-hash"] != hash {
+		return "config changed", nil
 	}
 
-	return configPath, d.executor.CopyFile(context.Background(), tmpFile.Name(), filepath.Join(configPath, "default.conf"))
+	return "", nil
 }
 
-func (d *Deployment) serviceChanged(project string, service *config.Service) (bool, error) {
-	containerInfo, err := d.getContainerInfo(service.Name, project)
-	if err != nil {
-		return false, fmt.Errorf("failed to get container info: %w", err)
+// dependencyService returns the service a dependency runs as.
+func dependencyService(dependency *config.Dependency) *config.Service {
+	return &config.Service{
+		Name:        dependency.Name,
+		Image:       dependency.Image,
+		Volumes:     dependency.Volumes,
+		EnvVars:     dependency.EnvVars,
+		HealthCheck: dependency.HealthCheck,
+		Runtime:     dependency.Runtime,
 	}
+}
 
-	hash, err := service.Hash()
-	if err != nil {
-		return false, fmt.Errorf("failed to generate config hash: %w", err)
+// dependencyDrift is serviceDrift for a dependency, whose config is compared by
+// its own hash. Containers started before that hash was labelled are compared
+// the way services are.
+func dependencyDrift(dependency *config.Dependency, container *containerInfo, imageHash, hash string) (string, error) {
+	label, ok := container.Config.Labels[dependencyHashLabel]
+	if !ok {
+		return serviceDrift(dependencyService(dependency), container, imageHash)
 	}
 
-	return containerInfo.Config.Labels["ftl.config-hash"] != hash, nil
-}
+	if imageHash != container.Image {
+		return "image changed", nil
+	}
 
-func (d *Deployment) deployService(project string, service *config.Service) error {
-	hash, err := d.pullImage(service.Image)
-	if err != nil {
-		return fmt.Errorf("failed to pull image for %s: %w", service.Name, err)
+	if label != hash {
+		return "config changed", nil
 	}
 
-	containerInfo, err := d.getContainerInfo(service.Name, project)
+	return "", nil
+}
+
+func (d *Deployment) deployService(ctx context.Context, project string, service *config.Service) error {
+	hash, err := d.provideImage(ctx, service)
 	if err != nil {
-		if err := d.InstallService(project, service); err != nil {
-			return fmt.Errorf("failed to install service %s: %w", service.Name, err)
-		}
+		return fmt.Errorf("failed to provide image for %s: %w", service.Name, err)
+	}
 
-		return nil
+	if err := d.reconcileService(ctx, project, service); err != nil {
+		return fmt.Errorf("failed to recover service %s: %w", service.Name, err)
 	}
 
-	if hash != containerInfo.Image {
-		if err := d.UpdateService(project, service); err != nil {
-			return fmt.Errorf("failed to update service %s due to image change: %w", service.Name, err)
+	containerInfo, err := d.getContainerInfo(ctx, service.Name, project)
+	if err != nil {
+		if err := d.InstallService(ctx, project, service); err != nil {
+			return fmt.Errorf("failed to install service %s: %w", service.Name, err)
 		}
 
+		console.Emit(console.Event{Type: console.EventServiceInstalled, Service: service.Name})
 		return nil
 	}
 
-	changed, err := d.serviceChanged(project, service)
+	drift, err := serviceDrift(service, containerInfo, hash)
 	if err != nil {
 		return fmt.Errorf("failed to check if service %s has changed: %w", service.Name, err)
 	}
 
-	if changed {
-		if err := d.UpdateService(project, service); err != nil {
-			return fmt.Errorf("failed to update service %s due to config change: %w", service.Name, err)
+	if drift != "" {
+		if err := d.UpdateService(ctx, project, service); err != nil {
+			return fmt.Errorf("failed to update service %s (%s): %w", service.Name, drift, err)
 		}
+
+		console.Emit(console.Event{Type: console.EventServiceUpdated, Service: service.Name, Message: drift})
+		return nil
 	}
 
+	console.Emit(console.Event{Type: console.EventServiceUnchanged, Service: service.Name})
 	return nil
 }
 
-func (d *Deployment) networkExists(network string) (bool, error) {
-	output, err := d.runCommand(context.Background(), "docker", "network", "ls", "--format", "{{.Name}}")
+func (d *Deployment) networkExists(ctx context.Context, network string) (bool, error) {
+	output, err := d.runCommand(ctx, "docker", "network", "ls", "--format", "{{.Name}}")
 	if err != nil {
 		return false, fmt.Errorf("failed to list Docker networks: %w", err)
 	}
@@ -502,8 +845,8 @@ func (d *Deployment) networkExists(network string) (bool, error) {
 	return false, nil
 }
 
-func (d *Deployment) createNetwork(network string) error {
-	exists, err := d.networkExists(network)
+func (d *Deployment) createNetwork(ctx context.Context, network string) error {
+	exists, err := d.networkExists(ctx, network)
 	if err != nil {
 		return fmt.Errorf("failed to check if network exists: %w", err)
 	}
@@ -512,7 +855,7 @@ func (d *Deployment) createNetwork(network string) error {
 		return nil
 	}
 
-	_, err = d.runCommand(context.Background(), "docker", "network", "create", network)
+	_, err = d.runCommand(ctx, "docker", "network", "create", network)
 	if err != nil {
 		return fmt.Errorf("failed to create network: %w", err)
 	}
@@ -520,13 +863,21 @@ func (d *Deployment) createNetwork(network string) error {
 	return nil
 }
 
-func (d *Deployment) createVolume(project, volume string) error {
-	volumeName := fmt.Sprintf("%s-%s", project, volume)
-	if _, err := d.runCommand(context.Background(), "docker", "volume", "inspect", volumeName); err == nil {
+func (d *Deployment) createVolume(ctx context.Context, project string, volume config.Volume) error {
+	name := volumeName(project, volume.Name)
+	if _, err := d.runCommand(ctx, "docker", "volume", "inspect", name); err == nil {
 		return nil
 	}
 
-	_, err := d.runCommand(context.Background(), "docker", "volume", "create", volumeName)
+	args := []string{"volume", "create"}
+	if volume.Driver != "" {
+		args = append(args, "--driver", volume.Driver)
+	}
+	for _, key := range sortedKeys(volume.DriverOpts) {
+		args = append(args, "--opt", fmt.Sprintf("%s=%s", key, volume.DriverOpts[key]))
+	}
+
+	_, err := d.runCommand(ctx, "docker", append(args, name)...)
 	if err != nil {
 		return fmt.Errorf("failed to create volume: %w", err)
 	}
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/yarlson/ftl/pkg/config"
@@ -51,6 +52,23 @@ func (e *LocalExecutor) CopyFile(ctx context.Context, src, dst string) error {
 	return cmd.Run()
 }
 
+func (e *LocalExecutor) StreamCommand(ctx context.Context, in io.Reader, out io.Writer, command string, args ...string) error {
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = in
+	cmd.Stdout = out
+
+	return cmd.Run()
+}
+
+func mounts(specs ...string) []config.Mount {
+	result := make([]config.Mount, len(specs))
+	for i, spec := range specs {
+		result[i], _ = config.ParseMount(spec)
+	}
+
+	return result
+}
+
 func (suite *DeploymentTestSuite) SetupSuite() {
 	suite.network = "ftl-test-network"
 	_ = exec.Command("docker", "network", "create", suite.network).Run()
@@ -88,6 +106,7 @@ func (suite *DeploymentTestSuite) inspectContainer(containerName string) map[str
 }
 
 func (suite *DeploymentTestSuite) TestDeploy() {
+	ctx := context.Background()
 	project := "test-project"
 
 	cfg := &config.Config{
@@ -111,11 +130,9 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 		},
 		Dependencies: []config.Dependency{
 			{
-				Name:  "postgres",
-				Image: "postgres:16",
-				Volumes: []string{
-					"postgres_data:/var/lib/postgresql/data",
-				},
+				Name:    "postgres",
+				Image:   "postgres:16",
+				Volumes: mounts("postgres_data:/var/lib/postgresql/data"),
 				EnvVars: map[string]string{
 					"POSTGRES_PASSWORD": "S3cret",
 					"POSTGRES_USER":     "test",
@@ -123,11 +140,9 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 				},
 			},
 			{
-				Name:  "mysql",
-				Image: "mysql:8",
-				Volumes: []string{
-					"mysql_data:/var/lib/mysql",
-				},
+				Name:    "mysql",
+				Image:   "mysql:8",
+				Volumes: mounts("mysql_data:/var/lib/mysql"),
 				EnvVars: map[string]string{
 					"MYSQL_ROOT_PASSWORD": "S3cret",
 					"MYSQL_DATABASE":      "test",
@@ -136,57 +151,49 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 				},
 			},
 			{
-				Name:  "mongodb",
-				Image: "mongo:latest",
-				Volumes: []string{
-					"mongodb_data:/data/db",
-				},
+				Name:    "mongodb",
+				Image:   "mongo:latest",
+				Volumes: mounts("mongodb_data:/data/db"),
 				EnvVars: map[string]string{
 					"MONGO_INITDB_ROOT_USERNAME": "root",
 					"MONGO_INITDB_ROOT_PASSWORD": "S3cret",
 				},
 			},
 			{
-				Name:  "redis",
-				Image: "redis:latest",
-				Volumes: []string{
-					"redis_data:/data",
-				},
+				Name:    "redis",
+				Image:   "redis:latest",
+				Volumes: mounts("redis_data:/data"),
 			},
 			{
-				Name:  "rabbitmq",
-				Image: "rabbitmq:management",
-				Volumes: []string{
-					"rabbitmq_data:/var/lib/rabbitmq",
-				},
+				Name:    "rabbitmq",
+				Image:   "rabbitmq:management",
+				Volumes: mounts("rabbitmq_data:/var/lib/rabbitmq"),
 				EnvVars: map[string]string{
 					"RABBITMQ_DEFAULT_USER": "user",
 					"RABBITMQ_DEFAULT_PASS": "S3cret",
 				},
 			},
 			{
-				Name:  "elasticsearch",
-				Image: "elasticsearch:7.14.0",
-				Volumes: []string{
-					"elasticsearch_data:/usr/share/elasticsearch/data",
-				},
+				Name:    "elasticsearch",
+				Image:   "elasticsearch:7.14.0",
+				Volumes: mounts("elasticsearch_data:/usr/share/elasticsearch/data"),
 				EnvVars: map[string]string{
 					"discovery.type": "single-node",
 					"ES_JAVA_OPTS":   "-Xms512m -Xmx512m",
 				},
 			},
 		},
-		Volumes: []string{
-			"postgres_data",
-			"mysql_data",
-			"mongodb_data",
-			"redis_data",
-			"rabbitmq_data",
-			"elasticsearch_data",
+		Volumes: []config.Volume{
+			{Name: "postgres_data"},
+			{Name: "mysql_data"},
+			{Name: "mongodb_data"},
+			{Name: "redis_data"},
+			{Name: "rabbitmq_data"},
+			{Name: "elasticsearch_data"},
 		},
 	}
 
-	projectPath, err := suite.updater.prepareProjectFolder(project)
+	projectPath, err := suite.updater.prepareProjectFolder(ctx, project)
 	assert.NoError(suite.T(), err)
 
 	proxyCertPath := filepath.Join(projectPath, "localhost.crt")
@@ -237,7 +244,7 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 	}()
 
 	suite.Run("Successful deployment", func() {
-		err = suite.updater.Deploy(project, cfg)
+		err = suite.updater.Deploy(ctx, project, cfg)
 		time.Sleep(5 * time.Second)
 
 		requestStats := struct {
@@ -245,14 +252,14 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 			failedRequests int32
 		}{}
 
-		ctx, cancel := context.WithCancel(context.Background())
+		requestsCtx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
 		for i := 0; i < 10; i++ {
 			go func() {
 				for {
 					select {
-					case <-ctx.Done():
+					case <-requestsCtx.Done():
 						return
 					default:
 						resp, err := http.Get("https://localhost/")
@@ -274,7 +281,7 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 
 		cfg.Services[0].Image = "nginx:1.20"
 
-		err = suite.updater.Deploy(project, cfg)
+		err = suite.updater.Deploy(ctx, project, cfg)
 		assert.NoError(suite.T(), err)
 
 		fmt.Printf("Total requests: %d\n", requestStats.totalRequests)
@@ -300,3 +307,36 @@ func (suite *DeploymentTestSuite) TestDeploy() {
 		})
 	})
 }
+
+func TestUpdatePublishedService(t *testing.T) {
+	service := &config.Service{
+		Name:     "proxy",
+		Image:    "nginx:1.27",
+		Forwards: []string{"80:80/tcp", "443:443/tcp"},
+		Runtime:  config.Runtime{Memory: "256m"},
+	}
+	hash, err := publishedHash(service)
+	require.NoError(t, err)
+
+	running := func() *dockerStub {
+		return &dockerStub{
+			containers: map[string]map[string][]string{"proxy": {"app": {"proxy"}}},
+			inspect: func(info *containerInfo) {
+				info.Image = "sha256:1234"
+				info.Config.Labels = map[string]string{publishedHashLabel: hash}
+			},
+		}
+	}
+
+	stub := running()
+	require.NoError(t, NewDeployment(stub).UpdateService(context.Background(), "app", service))
+	assert.Equal(t, []string{"docker update --restart unless-stopped --memory 256m proxy"}, stub.changes,
+		"a change that doesn't need a new container is applied in place")
+
+	service.Forwards = append(service.Forwards, "5432:5432/tcp")
+	stub = running()
+	require.NoError(t, NewDeployment(stub).UpdateService(context.Background(), "app", service))
+	require.NotEmpty(t, stub.changes)
+	assert.Equal(t, []string{"docker stop proxy", "docker rename proxy proxy_old"}, stub.changes[:2],
+		"new published ports need a new container")
+}
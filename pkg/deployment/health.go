@@ -0,0 +1,134 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+// sidecarImage is used for sidecar health checks that don't name an image. It
+// ships curl, and busybox's nc for TCP checks.
+const sidecarImage = "curlimages/curl:latest"
+
+func (d *Deployment) performHealthChecks(ctx context.Context, project, container string, service *config.Service) error {
+	healthCheck := service.HealthCheck
+	if healthCheck == nil {
+		return nil
+	}
+
+	if healthCheck.IsSidecar() {
+		return d.probeFromSidecar(ctx, project, container, service)
+	}
+
+	attempts := healthCheck.Retries
+	if healthCheck.Interval > 0 {
+		attempts += int(healthCheck.StartPeriod / healthCheck.Interval)
+	}
+
+	for i := 0; i < attempts; i++ {
+		output, err := d.runCommand(ctx, "docker", "inspect", "--format={{.State.Health.Status}}", container)
+		if err == nil && strings.TrimSpace(output) == "healthy" {
+			return nil
+		}
+		if err := sleep(ctx, healthCheck.Interval); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("container failed to become healthy")
+}
+
+// probeFromSidecar runs the health check from a throwaway container on the project
+// network, for images that lack the tools a check needs or aren't HTTP servers.
+func (d *Deployment) probeFromSidecar(ctx context.Context, project, container string, service *config.Service) error {
+	healthCheck := service.HealthCheck
+
+	image := healthCheck.Image
+	if image == "" {
+		image = sidecarImage
+	}
+	if _, err := d.pullImage(ctx, image); err != nil {
+		return fmt.Errorf("failed to pull health check image %s: %w", image, err)
+	}
+
+	if err := sleep(ctx, healthCheck.StartPeriod); err != nil {
+		return err
+	}
+
+	probe := healthCommand(healthCheck, container, healthCheckPort(service))
+
+	var err error
+	for i := 0; i < healthCheck.Retries; i++ {
+		_, err = d.runCommand(ctx, "docker", "run", "--rm", "--network", project, "--entrypoint", "sh", image, "-c", probe)
+		if err == nil {
+			return nil
+		}
+		if err := sleep(ctx, healthCheck.Interval); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("container failed to become healthy: %v", err)
+}
+
+func healthCheckPort(service *config.Service) int {
+	if service.HealthCheck.Port != 0 {
+		return service.HealthCheck.Port
+	}
+
+	return service.Port
+}
+
+// healthCommand returns the shell command that checks host:port according to the
+// health check type. It exits non-zero when the check fails.
+func healthCommand(healthCheck *config.HealthCheck, host string, port int) string {
+	timeout := healthCheck.Timeout.Seconds()
+
+	switch healthCheck.Type {
+	case "cmd":
+		return healthCheck.Command
+	case "tcp":
+		waitFlag := ""
+		if timeout > 0 {
+			waitFlag = fmt.Sprintf(" -w %d", int(math.Ceil(timeout)))
+		}
+		return fmt.Sprintf("nc -z%s %s %d || exit 1", waitFlag, host, port)
+	}
+
+	curl := func(failOnError bool) string {
+		command := "curl -s"
+		if failOnError {
+			command += "f"
+		}
+		if timeout > 0 {
+			command += " -m " + strconv.FormatFloat(timeout, 'f', -1, 64)
+		}
+		return command
+	}
+	url := fmt.Sprintf("http://%s:%d%s", host, port, healthCheck.Path)
+
+	var checks []string
+	if len(healthCheck.ExpectedStatus) > 0 {
+		codes := make([]string, len(healthCheck.ExpectedStatus))
+		for i, code := range healthCheck.ExpectedStatus {
+			codes[i] = strconv.Itoa(code)
+		}
+		checks = append(checks, fmt.Sprintf("%s -o /dev/null -w '%%{http_code}' %s | grep -qxE '%s'", curl(false), url, strings.Join(codes, "|")))
+	}
+
+	if healthCheck.ExpectedBody != "" {
+		checks = append(checks, fmt.Sprintf("%s %s | grep -qF -- %s", curl(len(healthCheck.ExpectedStatus) == 0), url, shellQuote(healthCheck.ExpectedBody)))
+	}
+
+	if len(checks) == 0 {
+		checks = append(checks, curl(true)+" "+url)
+	}
+
+	return strings.Join(checks, " && ") + " || exit 1"
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,63 @@
+package deployment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestHealthCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthCheck config.HealthCheck
+		expected    string
+	}{
+		{
+			name:        "http",
+			healthCheck: config.HealthCheck{Path: "/health"},
+			expected:    "curl -sf http://localhost:8080/health || exit 1",
+		},
+		{
+			name:        "http with timeout",
+			healthCheck: config.HealthCheck{Type: "http", Path: "/", Timeout: 1500 * time.Millisecond},
+			expected:    "curl -sf -m 1.5 http://localhost:8080/ || exit 1",
+		},
+		{
+			name:        "http with expected status and body",
+			healthCheck: config.HealthCheck{Path: "/ready", ExpectedStatus: []int{200, 204}, ExpectedBody: "it's ok"},
+			expected:    `curl -s -o /dev/null -w '%{http_code}' http://localhost:8080/ready | grep -qxE '200|204' && curl -s http://localhost:8080/ready | grep -qF -- 'it'\''s ok' || exit 1`,
+		},
+		{
+			name:        "http with expected body",
+			healthCheck: config.HealthCheck{Path: "/", ExpectedBody: "ready"},
+			expected:    "curl -sf http://localhost:8080/ | grep -qF -- 'ready' || exit 1",
+		},
+		{
+			name:        "tcp",
+			healthCheck: config.HealthCheck{Type: "tcp", Timeout: 2 * time.Second},
+			expected:    "nc -z -w 2 localhost 8080 || exit 1",
+		},
+		{
+			name:        "cmd",
+			healthCheck: config.HealthCheck{Type: "cmd", Command: "pg_isready -U postgres"},
+			expected:    "pg_isready -U postgres",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, healthCommand(&tt.healthCheck, "localhost", 8080))
+		})
+	}
+}
+
+func TestHealthCheckPort(t *testing.T) {
+	service := &config.Service{Port: 80, HealthCheck: &config.HealthCheck{}}
+	assert.Equal(t, 80, healthCheckPort(service))
+
+	service.HealthCheck.Port = 9090
+	assert.Equal(t, 9090, healthCheckPort(service))
+}
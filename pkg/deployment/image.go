@@ -0,0 +1,92 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yarlson/ftl/pkg/build"
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+// provideImage makes the image of the service available on the server, the way
+// its build mode says, and returns the image ID.
+func (d *Deployment) provideImage(ctx context.Context, service *config.Service) (string, error) {
+	switch service.BuildMode() {
+	case config.BuildRemote:
+		if err := d.buildRemote(ctx, service); err != nil {
+			return "", err
+		}
+	case config.BuildLoad:
+		if err := d.loadImage(ctx, service.Image); err != nil {
+			return "", err
+		}
+	default:
+		return d.pullImage(ctx, service.Image)
+	}
+
+	return d.imageID(ctx, service.Image)
+}
+
+// ensureImage pulls the image of the service, or checks that it's on the server
+// when it's built there or loaded rather than pulled from a registry.
+func (d *Deployment) ensureImage(ctx context.Context, service *config.Service) error {
+	if service.BuildMode() == config.BuildRegistry {
+		_, err := d.pullImage(ctx, service.Image)
+		return err
+	}
+
+	_, err := d.imageID(ctx, service.Image)
+	return err
+}
+
+// buildRemote streams the build context of the service to the server and builds
+// the image there, for the server's own platform. Docker's build cache on the
+// server keeps rebuilds of unchanged layers cheap.
+func (d *Deployment) buildRemote(ctx context.Context, service *config.Service) error {
+	buildContext, err := build.Context(service.BuildContext())
+	if err != nil {
+		return err
+	}
+	defer buildContext.Close()
+
+	if err := d.executor.StreamCommand(ctx, buildContext, nil, "docker", build.Args(service, "-", nil, false)...); err != nil {
+		return fmt.Errorf("failed to build image %s on the server: %w", service.Image, err)
+	}
+
+	return nil
+}
+
+// loadImage copies the image from the local Docker to the server. The copy is
+// skipped when the server already has an image with the same ID; otherwise the
+// whole image is sent, as docker load needs every layer in the archive.
+func (d *Deployment) loadImage(ctx context.Context, image string) error {
+	localID, err := build.ImageID(ctx, image)
+	if err != nil {
+		return err
+	}
+
+	if remoteID, err := d.imageID(ctx, image); err == nil && remoteID == localID {
+		return nil
+	}
+
+	archive, err := build.Save(ctx, image)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if err := d.executor.StreamCommand(ctx, archive, nil, "docker", "load"); err != nil {
+		return fmt.Errorf("failed to load image %s on the server: %w", image, err)
+	}
+
+	return nil
+}
+
+func (d *Deployment) imageID(ctx context.Context, image string) (string, error) {
+	output, err := d.runCommand(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", image)
+	if err != nil {
+		return "", fmt.Errorf("image %s not found on the server: %w", image, err)
+	}
+
+	return output, nil
+}
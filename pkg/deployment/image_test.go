@@ -0,0 +1,41 @@
+package deployment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestProvideImage_Remote(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine:3\n"), 0o644))
+
+	service := &config.Service{Name: "web", Image: "web:latest", Path: dir, Build: &config.Build{Mode: config.BuildRemote}}
+
+	stub := &dockerStub{}
+	id, err := NewDeployment(stub).provideImage(context.Background(), service)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:1234", id)
+
+	require.Len(t, stub.changes, 1)
+	assert.True(t, strings.HasPrefix(stub.changes[0], "docker build -t web:latest --progress plain - < "), stub.changes[0])
+}
+
+func TestEnsureImage(t *testing.T) {
+	stub := &dockerStub{}
+	deploy := NewDeployment(stub)
+
+	service := &config.Service{Name: "web", Image: "web:latest", Build: &config.Build{Mode: config.BuildLoad}}
+	require.NoError(t, deploy.ensureImage(context.Background(), service))
+
+	service.Build = nil
+	require.NoError(t, deploy.ensureImage(context.Background(), service))
+	assert.Empty(t, stub.changes)
+}
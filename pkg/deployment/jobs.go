@@ -0,0 +1,301 @@
+package deployment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+)
+
+const (
+	jobsDir        = "jobs"
+	jobHistoryFile = "history"
+
+	// The scheduler is a cron daemon in a container with the Docker CLI, which
+	// starts every job run as a one-off container on the project network.
+	schedulerName     = config.SchedulerName
+	schedulerImage    = "docker:cli"
+	schedulerJobsPath = "/ftl/jobs"
+)
+
+// runScript runs a job, keeps the output of its last run in logs/<name>.log and
+// appends the result to the history file as a tab-separated line.
+const runScript = `#!/bin/sh
+dir=` + schedulerJobsPath + `
+name="$1"
+started=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+mkdir -p "$dir/logs"
+{ "$dir/$name.sh" 2>&1; echo $? > "$dir/logs/$name.code"; } | tee "$dir/logs/$name.log"
+code=$(cat "$dir/logs/$name.code")
+finished=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+printf '%s\t%s\t%s\t%s\n' "$name" "$started" "$finished" "$code" >> "$dir/` + jobHistoryFile + `"
+exit "$code"
+`
+
+// JobRun is one run of a job as recorded in the history.
+type JobRun struct {
+	Job        string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	ExitCode   int
+}
+
+// SyncJobs uploads the job definitions and deploys the scheduler that runs them.
+// The scheduler is recreated when the jobs change. Without jobs, a scheduler left
+// from an earlier deploy is removed.
+func (d *Deployment) SyncJobs(ctx context.Context, project string, cfg *config.Config) error {
+	jobs, err := d.scheduledJobs(ctx, project, cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(jobs) == 0 {
+		container, err := d.inspectContainer(ctx, schedulerName)
+		if err != nil || container == nil {
+			return err
+		}
+
+		if _, err := d.runCommand(ctx, "docker", "rm", "-f", schedulerName); err != nil {
+			return fmt.Errorf("failed to remove scheduler: %w", err)
+		}
+		return nil
+	}
+
+	projectPath, err := d.prepareProjectFolder(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to prepare project folder: %w", err)
+	}
+
+	dir := filepath.Join(projectPath, jobsDir)
+	if _, err := d.runCommand(ctx, "mkdir", "-p", filepath.Join(dir, "crontabs"), filepath.Join(dir, "logs")); err != nil {
+		return fmt.Errorf("failed to create jobs folder: %w", err)
+	}
+
+	files := renderJobs(project, projectPath, jobs)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := d.copyContent(ctx, files[name], path); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+
+		mode := "644"
+		switch filepath.Ext(name) {
+		case ".sh":
+			mode = "755"
+		case ".env":
+			mode = "600"
+		}
+		if _, err := d.runCommand(ctx, "chmod", mode, path); err != nil {
+			return fmt.Errorf("failed to set permissions of %s: %w", name, err)
+		}
+
+		fmt.Fprintf(hash, "%s\x00%s\x00", name, files[name])
+	}
+
+	// Images of services that aren't pushed to a registry were built on or loaded
+	// into the server by the deploy, so there's nothing to pull.
+	local := make(map[string]bool)
+	for _, service := range cfg.Services {
+		if service.BuildMode() != config.BuildRegistry {
+			local[service.Image] = true
+		}
+	}
+
+	for _, job := range jobs {
+		if local[job.Image] {
+			continue
+		}
+		if _, err := d.pullImage(ctx, job.Image); err != nil {
+			return fmt.Errorf("failed to pull image for job %s: %w", job.Name, err)
+		}
+	}
+
+	scheduler := &config.Service{
+		Name:  schedulerName,
+		Image: schedulerImage,
+		Kind:  "worker",
+		Volumes: []config.Mount{
+			{Type: config.MountBind, Source: "/var/run/docker.sock", Target: "/var/run/docker.sock"},
+			{Type: config.MountBind, Source: dir, Target: schedulerJobsPath},
+		},
+		Runtime: config.Runtime{
+			Command: []string{"crond", "-f", "-c", schedulerJobsPath + "/crontabs"},
+		},
+		EnvVars: map[string]string{
+			"FTL_JOBS_DIGEST": hex.EncodeToString(hash.Sum(nil))[:12],
+		},
+	}
+
+	if err := d.deployScheduler(ctx, project, scheduler); err != nil {
+		return fmt.Errorf("failed to deploy scheduler: %w", err)
+	}
+
+	return nil
+}
+
+// deployScheduler installs the scheduler or, when it changed, replaces it by
+// stopping the old container before the new one starts. Unlike a worker, two
+// schedulers must never run side by side, as both would start every job.
+func (d *Deployment) deployScheduler(ctx context.Context, project string, scheduler *config.Service) error {
+	hash, err := d.provideImage(ctx, scheduler)
+	if err != nil {
+		return fmt.Errorf("failed to provide image for %s: %w", scheduler.Name, err)
+	}
+
+	if err := d.reconcileService(ctx, project, scheduler); err != nil {
+		return fmt.Errorf("failed to recover service %s: %w", scheduler.Name, err)
+	}
+
+	containerInfo, err := d.getContainerInfo(ctx, scheduler.Name, project)
+	if err != nil {
+		if err := d.InstallService(ctx, project, scheduler); err != nil {
+			return fmt.Errorf("failed to install service %s: %w", scheduler.Name, err)
+		}
+
+		console.Emit(console.Event{Type: console.EventServiceInstalled, Service: scheduler.Name})
+		return nil
+	}
+
+	drift, err := serviceDrift(scheduler, containerInfo, hash)
+	if err != nil {
+		return fmt.Errorf("failed to check if service %s has changed: %w", scheduler.Name, err)
+	}
+
+	if drift == "" {
+		console.Emit(console.Event{Type: console.EventServiceUnchanged, Service: scheduler.Name})
+		return nil
+	}
+
+	if err := d.recreateService(ctx, project, scheduler); err != nil {
+		return fmt.Errorf("failed to update service %s (%s): %w", scheduler.Name, drift, err)
+	}
+
+	console.Emit(console.Event{Type: console.EventServiceUpdated, Service: scheduler.Name, Message: drift})
+	return nil
+}
+
+// RunJob runs a job right away through the scheduler and returns its output. The
+// run is recorded in the history like a scheduled one.
+func (d *Deployment) RunJob(ctx context.Context, name string) (string, error) {
+	output, err := d.executor.RunCommand(ctx, "docker", "exec", schedulerName, schedulerJobsPath+"/run.sh", name)
+
+	var content []byte
+	if output != nil {
+		content, _ = io.ReadAll(output)
+	}
+	if err != nil {
+		return string(content), fmt.Errorf("job %s failed: %w", name, err)
+	}
+
+	return string(content), nil
+}
+
+// JobHistory returns the last runs of the project's jobs, oldest first. With a
+// name, only the runs of that job are returned.
+func (d *Deployment) JobHistory(ctx context.Context, project, name string, limit int) ([]JobRun, error) {
+	projectPath, err := d.projectFolder(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(projectPath, jobsDir, jobHistoryFile)
+	if _, err := d.runCommand(ctx, "test", "-f", path); err != nil {
+		return nil, nil
+	}
+
+	output, err := d.runCommand(ctx, "cat", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+
+	runs := parseJobHistory(output, name)
+	if limit > 0 && len(runs) > limit {
+		runs = runs[len(runs)-limit:]
+	}
+
+	return runs, nil
+}
+
+// renderJobs returns the files the scheduler reads, keyed by path relative to the
+// jobs folder: the crontab, the run script, and a launch script and env file for
+// every job. Relative paths in the job volumes are resolved against projectPath.
+func renderJobs(project, projectPath string, jobs []config.Job) map[string]string {
+	var crontab strings.Builder
+	files := map[string]string{"run.sh": runScript}
+
+	for _, job := range jobs {
+		fmt.Fprintf(&crontab, "%s %s/run.sh %s\n", job.Schedule, schedulerJobsPath, job.Name)
+
+		args := []string{"docker", "run", "--rm", "--network", project, "--label", "ftl.job=" + job.Name}
+		if len(job.EnvVars) > 0 {
+			args = append(args, "--env-file", fmt.Sprintf("%s/%s.env", schedulerJobsPath, job.Name))
+		}
+		for _, mount := range job.Volumes {
+			args = append(args, "--mount", mountArg(project, projectPath, mount))
+		}
+		args = append(args, job.Image)
+		args = append(args, job.Command...)
+
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		files[job.Name+".sh"] = "#!/bin/sh\nexec " + strings.Join(quoted, " ") + "\n"
+
+		if len(job.EnvVars) > 0 {
+			var env strings.Builder
+			for _, key := range sortedKeys(job.EnvVars) {
+				fmt.Fprintf(&env, "%s=%s\n", key, job.EnvVars[key])
+			}
+			files[job.Name+".env"] = env.String()
+		}
+	}
+
+	files["crontabs/root"] = crontab.String()
+
+	return files
+}
+
+func parseJobHistory(output, name string) []JobRun {
+	var runs []JobRun
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 4 || (name != "" && fields[0] != name) {
+			continue
+		}
+
+		startedAt, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			continue
+		}
+		finishedAt, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			continue
+		}
+		exitCode, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+
+		runs = append(runs, JobRun{Job: fields[0], StartedAt: startedAt, FinishedAt: finishedAt, ExitCode: exitCode})
+	}
+
+	return runs
+}
@@ -0,0 +1,86 @@
+package deployment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestRenderJobs(t *testing.T) {
+	jobs := []config.Job{
+		{
+			Name:     "report",
+			Schedule: "0 3 * * *",
+			Image:    "my-app:latest",
+			Command:  []string{"bin/report", "--since", "yesterday's close"},
+			EnvVars:  map[string]string{"TOKEN": "s3cret", "DATABASE_URL": "postgres://db/app"},
+			Volumes:  mounts("reports:/reports", "./exports:/exports:ro"),
+		},
+		{
+			Name:     "cleanup",
+			Schedule: "*/15 * * * *",
+			Image:    "busybox",
+		},
+	}
+
+	files := renderJobs("my-project", "/home/ftl/projects/my-project", jobs)
+
+	assert.Equal(t, "0 3 * * * /ftl/jobs/run.sh report\n*/15 * * * * /ftl/jobs/run.sh cleanup\n", files["crontabs/root"])
+	assert.Equal(t, "#!/bin/sh\nexec 'docker' 'run' '--rm' '--network' 'my-project' '--label' 'ftl.job=report' "+
+		"'--env-file' '/ftl/jobs/report.env' '--mount' 'type=volume,source=my-project-reports,target=/reports' "+
+		"'--mount' 'type=bind,source=/home/ftl/projects/my-project/exports,target=/exports,readonly' 'my-app:latest' "+
+		"'bin/report' '--since' 'yesterday'\\''s close'\n", files["report.sh"])
+	assert.Equal(t, "DATABASE_URL=postgres://db/app\nTOKEN=s3cret\n", files["report.env"])
+	assert.Equal(t, "#!/bin/sh\nexec 'docker' 'run' '--rm' '--network' 'my-project' '--label' 'ftl.job=cleanup' 'busybox'\n", files["cleanup.sh"])
+	assert.NotContains(t, files, "cleanup.env")
+	assert.Equal(t, runScript, files["run.sh"])
+}
+
+func TestParseJobHistory(t *testing.T) {
+	output := "report\t2026-10-18T03:00:00Z\t2026-10-18T03:00:42Z\t0\n" +
+		"cleanup\t2026-10-18T03:15:00Z\t2026-10-18T03:15:01Z\t1\n" +
+		"garbage line\n"
+
+	runs := parseJobHistory(output, "")
+	assert.Equal(t, []JobRun{
+		{
+			Job:        "report",
+			StartedAt:  time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC),
+			FinishedAt: time.Date(2026, 10, 18, 3, 0, 42, 0, time.UTC),
+			ExitCode:   0,
+		},
+		{
+			Job:        "cleanup",
+			StartedAt:  time.Date(2026, 10, 18, 3, 15, 0, 0, time.UTC),
+			FinishedAt: time.Date(2026, 10, 18, 3, 15, 1, 0, time.UTC),
+			ExitCode:   1,
+		},
+	}, runs)
+
+	runs = parseJobHistory(output, "cleanup")
+	assert.Len(t, runs, 1)
+	assert.Equal(t, 1, runs[0].ExitCode)
+}
+
+func TestDeployScheduler_StopsOldFirst(t *testing.T) {
+	stub := &dockerStub{containers: map[string]map[string][]string{schedulerName: {"app": {schedulerName}}}}
+	deploy := NewDeployment(stub)
+
+	scheduler := &config.Service{
+		Name:    schedulerName,
+		Image:   schedulerImage,
+		Kind:    "worker",
+		EnvVars: map[string]string{"FTL_JOBS_DIGEST": "changed"},
+	}
+
+	require.NoError(t, deploy.deployScheduler(context.Background(), "app", scheduler))
+	require.NotEmpty(t, stub.changes)
+	assert.Equal(t, []string{"docker stop scheduler", "docker rename scheduler scheduler_old"}, stub.changes[:2])
+	assert.Contains(t, stub.changes[2], "docker run -d --name scheduler --network app")
+	assert.Equal(t, "docker rm scheduler", stub.changes[len(stub.changes)-1])
+}
@@ -0,0 +1,286 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/console"
+)
+
+const (
+	lockDir  = ".deploy.lock"
+	lockFile = "info.json"
+
+	// LockStaleAfter is how long a lock may go without a heartbeat before it's
+	// assumed to be left behind by a deploy that died without releasing it.
+	LockStaleAfter = 5 * time.Minute
+
+	lockPollInterval = 2 * time.Second
+)
+
+// lockHeartbeatInterval is how often the holder refreshes its heartbeat, well
+// within LockStaleAfter so a slow write or two don't make the lock look stale.
+var lockHeartbeatInterval = time.Minute
+
+// LockInfo describes who holds the deploy lock of a project on a server.
+type LockInfo struct {
+	Owner      string    `json:"owner"`
+	Host       string    `json:"host"`
+	PID        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	// HeartbeatAt is refreshed by the holder for as long as it holds the lock.
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+}
+
+func (i *LockInfo) String() string {
+	return fmt.Sprintf("%s@%s (pid %d) since %s", i.Owner, i.Host, i.PID, i.AcquiredAt.Local().Format(time.RFC3339))
+}
+
+// IsStale reports whether the lock was abandoned: its holder hasn't refreshed
+// the heartbeat for LockStaleAfter, or it was taken on this machine by a process
+// that no longer runs.
+func (i *LockInfo) IsStale() bool {
+	heartbeat := i.HeartbeatAt
+	if heartbeat.IsZero() {
+		heartbeat = i.AcquiredAt
+	}
+	if time.Since(heartbeat) > LockStaleAfter {
+		return true
+	}
+
+	hostname, _ := os.Hostname()
+	if i.Host != hostname || i.PID <= 0 {
+		return false
+	}
+
+	process, err := os.FindProcess(i.PID)
+	if err != nil {
+		return true
+	}
+
+	return process.Signal(syscall.Signal(0)) == os.ErrProcessDone
+}
+
+// LockedError is returned when another deploy holds the lock.
+type LockedError struct {
+	Info *LockInfo
+}
+
+func (e *LockedError) Error() string {
+	if e.Info == nil {
+		return "project is locked by another deploy; retry with --wait or run 'ftl lock break'"
+	}
+
+	return fmt.Sprintf("project is locked by %s; retry with --wait or run 'ftl lock break'", e.Info)
+}
+
+func newLockInfo() *LockInfo {
+	owner := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		owner = current.Username
+	}
+	hostname, _ := os.Hostname()
+	now := time.Now().UTC()
+
+	return &LockInfo{
+		Owner:       owner,
+		Host:        hostname,
+		PID:         os.Getpid(),
+		AcquiredAt:  now,
+		HeartbeatAt: now,
+	}
+}
+
+// AcquireLock takes the deploy lock of the project, waiting up to wait for another
+// deploy to release it. Stale locks are broken with a warning. The lock is a
+// directory, since mkdir either creates it or fails atomically. Its heartbeat is
+// refreshed in the background until ReleaseLock.
+func (d *Deployment) AcquireLock(ctx context.Context, project string, wait time.Duration) error {
+	path, err := d.lockPath(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		if _, err := d.runCommand(ctx, "mkdir", path); err == nil {
+			info := newLockInfo()
+			if err := d.writeLock(ctx, path, info); err != nil {
+				_, _ = d.runCommand(ctx, "rm", "-rf", path)
+				return err
+			}
+			d.startHeartbeat(project, path, info)
+			return nil
+		}
+
+		info, err := d.readLock(ctx, path)
+		if err != nil {
+			return err
+		}
+
+		if info != nil && info.IsStale() {
+			console.Warning(fmt.Sprintf("Breaking stale deploy lock held by %s", info))
+			if _, err := d.runCommand(ctx, "rm", "-rf", path); err != nil {
+				return fmt.Errorf("failed to break stale lock: %w", err)
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return &LockedError{Info: info}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// ReleaseLock removes the deploy lock of the project.
+func (d *Deployment) ReleaseLock(ctx context.Context, project string) error {
+	path, err := d.lockPath(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	d.stopHeartbeat(project)
+
+	if _, err := d.runCommand(ctx, "rm", "-rf", path); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	return nil
+}
+
+// releaseLock releases the lock at the end of an operation, when there's no
+// error to return it through. It still runs when the operation was cancelled.
+func (d *Deployment) releaseLock(ctx context.Context, project string) {
+	if err := d.ReleaseLock(context.WithoutCancel(ctx), project); err != nil {
+		console.Warning(fmt.Sprintf("Failed to release deploy lock: %v", err))
+	}
+}
+
+// LockStatus returns the holder of the deploy lock, or nil when the project isn't
+// locked. A lock whose info hasn't been written yet is reported with an empty
+// LockInfo.
+func (d *Deployment) LockStatus(ctx context.Context, project string) (*LockInfo, error) {
+	path, err := d.lockPath(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.runCommand(ctx, "test", "-d", path); err != nil {
+		return nil, nil
+	}
+
+	info, err := d.readLock(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		info = &LockInfo{}
+	}
+
+	return info, nil
+}
+
+// writeLock writes the lock info next to it and moves it in place, so readers
+// never see it half-written.
+func (d *Deployment) writeLock(ctx context.Context, path string, info *LockInfo) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode lock info: %w", err)
+	}
+
+	file := filepath.Join(path, lockFile)
+	if err := d.copyContent(ctx, string(content), file+".tmp"); err != nil {
+		return fmt.Errorf("failed to write lock info: %w", err)
+	}
+	if _, err := d.runCommand(ctx, "mv", "-f", file+".tmp", file); err != nil {
+		return fmt.Errorf("failed to write lock info: %w", err)
+	}
+
+	return nil
+}
+
+// heartbeat refreshes the heartbeat of a held lock until it's stopped.
+type heartbeat struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (d *Deployment) startHeartbeat(project, path string, info *LockInfo) {
+	h := &heartbeat{stop: make(chan struct{}), done: make(chan struct{})}
+
+	d.heartbeatsMu.Lock()
+	if d.heartbeats == nil {
+		d.heartbeats = make(map[string]*heartbeat)
+	}
+	d.heartbeats[project] = h
+	d.heartbeatsMu.Unlock()
+
+	go func() {
+		defer close(h.done)
+
+		ticker := time.NewTicker(lockHeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.stop:
+				return
+			case <-ticker.C:
+				info.HeartbeatAt = time.Now().UTC()
+				if err := d.writeLock(context.Background(), path, info); err != nil {
+					console.Warning(fmt.Sprintf("Failed to refresh deploy lock: %v", err))
+				}
+			}
+		}
+	}()
+}
+
+// stopHeartbeat stops refreshing the lock and waits for a refresh in progress,
+// so it can't write into a lock taken by someone else after the release.
+func (d *Deployment) stopHeartbeat(project string) {
+	d.heartbeatsMu.Lock()
+	h := d.heartbeats[project]
+	delete(d.heartbeats, project)
+	d.heartbeatsMu.Unlock()
+
+	if h != nil {
+		close(h.stop)
+		<-h.done
+	}
+}
+
+func (d *Deployment) readLock(ctx context.Context, path string) (*LockInfo, error) {
+	content, err := d.runCommand(ctx, "cat", filepath.Join(path, lockFile))
+	if err != nil {
+		// The holder has created the directory but not written its info yet.
+		return nil, nil
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal([]byte(content), &info); err != nil {
+		return nil, fmt.Errorf("failed to decode lock info: %w", err)
+	}
+
+	return &info, nil
+}
+
+func (d *Deployment) lockPath(ctx context.Context, project string) (string, error) {
+	projectPath, err := d.prepareProjectFolder(ctx, project)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare project folder: %w", err)
+	}
+
+	return filepath.Join(projectPath, lockDir), nil
+}
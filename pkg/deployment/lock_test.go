@@ -0,0 +1,120 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeployLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+
+	deploy := NewDeployment(&LocalExecutor{})
+	other := NewDeployment(&LocalExecutor{})
+
+	info, err := deploy.LockStatus(ctx, "test-project")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+
+	require.NoError(t, deploy.AcquireLock(ctx, "test-project", 0))
+
+	info, err = other.LockStatus(ctx, "test-project")
+	require.NoError(t, err)
+	require.NotNil(t, info)
+	assert.Equal(t, os.Getpid(), info.PID)
+	assert.False(t, info.IsStale())
+
+	err = other.AcquireLock(ctx, "test-project", 0)
+	var lockedErr *LockedError
+	require.True(t, errors.As(err, &lockedErr))
+	assert.Equal(t, os.Getpid(), lockedErr.Info.PID)
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		_ = deploy.ReleaseLock(ctx, "test-project")
+	}()
+	require.NoError(t, other.AcquireLock(ctx, "test-project", 5*time.Second))
+	require.NoError(t, other.ReleaseLock(ctx, "test-project"))
+
+	info, err = deploy.LockStatus(ctx, "test-project")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestDeployLock_Stale(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	lockPath := filepath.Join(os.Getenv("HOME"), "projects", "test-project", lockDir)
+	require.NoError(t, os.MkdirAll(lockPath, 0755))
+
+	content, err := json.Marshal(LockInfo{
+		Owner:      "ci",
+		Host:       "runner-1",
+		PID:        4242,
+		AcquiredAt: time.Now().Add(-2 * LockStaleAfter),
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(lockPath, lockFile), content, 0644))
+
+	ctx := context.Background()
+	deploy := NewDeployment(&LocalExecutor{})
+	require.NoError(t, deploy.AcquireLock(ctx, "test-project", 0))
+
+	info, err := deploy.LockStatus(ctx, "test-project")
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), info.PID)
+}
+
+func TestDeployLock_Heartbeat(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer func(interval time.Duration) { lockHeartbeatInterval = interval }(lockHeartbeatInterval)
+	lockHeartbeatInterval = 50 * time.Millisecond
+
+	ctx := context.Background()
+	deploy := NewDeployment(&LocalExecutor{})
+	require.NoError(t, deploy.AcquireLock(ctx, "test-project", 0))
+
+	require.Eventually(t, func() bool {
+		info, err := deploy.LockStatus(ctx, "test-project")
+		return err == nil && info != nil && info.HeartbeatAt.After(info.AcquiredAt)
+	}, 2*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, deploy.ReleaseLock(ctx, "test-project"))
+	time.Sleep(3 * lockHeartbeatInterval)
+
+	info, err := deploy.LockStatus(ctx, "test-project")
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestLockInfo_IsStale(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	fresh := &LockInfo{Host: "elsewhere", PID: 1, AcquiredAt: time.Now()}
+	assert.False(t, fresh.IsStale())
+
+	old := &LockInfo{Host: "elsewhere", PID: 1, AcquiredAt: time.Now().Add(-LockStaleAfter - time.Minute)}
+	assert.True(t, old.IsStale())
+
+	longRunning := &LockInfo{Host: "elsewhere", PID: 1, AcquiredAt: time.Now().Add(-time.Hour), HeartbeatAt: time.Now()}
+	assert.False(t, longRunning.IsStale())
+
+	silent := &LockInfo{Host: "elsewhere", PID: 1, AcquiredAt: time.Now().Add(-time.Hour), HeartbeatAt: time.Now().Add(-LockStaleAfter - time.Minute)}
+	assert.True(t, silent.IsStale())
+
+	running := &LockInfo{Host: hostname, PID: os.Getpid(), AcquiredAt: time.Now()}
+	assert.False(t, running.IsStale())
+
+	// PIDs are capped well below this value on Linux and macOS.
+	gone := &LockInfo{Host: hostname, PID: 1 << 30, AcquiredAt: time.Now()}
+	assert.True(t, gone.IsStale())
+}
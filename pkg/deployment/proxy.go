@@ -0,0 +1,179 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/yarlson/ftl/pkg/certs"
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/proxy"
+)
+
+const stagingDir = ".staging"
+
+func (d *Deployment) StartProxy(ctx context.Context, project string, cfg *config.Config) error {
+	backend, err := proxy.NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+
+	projectPath, err := d.prepareProjectFolder(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to prepare project folder: %w", err)
+	}
+
+	certChanged, err := d.installCertificate(ctx, cfg, projectPath)
+	if err != nil {
+		return fmt.Errorf("failed to install certificate: %w", err)
+	}
+
+	configChanged, err := d.prepareProxyConfig(ctx, project, cfg, backend, projectPath)
+	if err != nil {
+		return fmt.Errorf("failed to prepare %s config: %w", backend.Name(), err)
+	}
+
+	service := backend.Service(cfg, projectPath)
+
+	oldContID, _ := d.getContainerID(ctx, project, service.Name)
+
+	if err := d.deployService(ctx, project, service); err != nil {
+		return fmt.Errorf("failed to deploy service %s: %w", service.Name, err)
+	}
+
+	newContID, err := d.getContainerID(ctx, project, service.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get proxy container ID: %w", err)
+	}
+
+	// A new container reads the fresh config on start; only a proxy that kept
+	// running needs to be told about it.
+	if (configChanged || certChanged) && oldContID == newContID {
+		args := append([]string{"exec", newContID}, backend.ReloadCommand()...)
+		if _, err := d.runCommand(ctx, "docker", args...); err != nil {
+			return fmt.Errorf("failed to reload proxy: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// prepareProxyConfig renders the proxy configuration into a staging directory,
+// checks it in a throwaway proxy container and only then moves it over the live
+// configuration. It reports whether the live configuration changed.
+func (d *Deployment) prepareProxyConfig(ctx context.Context, project string, cfg *config.Config, backend proxy.Backend, projectPath string) (bool, error) {
+	files, err := backend.Render(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	stagingPath := filepath.Join(projectPath, stagingDir)
+	if _, err := d.runCommand(ctx, "rm", "-rf", stagingPath); err != nil {
+		return false, fmt.Errorf("failed to clean staging directory: %w", err)
+	}
+	defer func() {
+		_, _ = d.runCommand(ctx, "rm", "-rf", stagingPath)
+	}()
+
+	for name := range files {
+		dir := filepath.Dir(name)
+		if _, err := d.runCommand(ctx, "mkdir", "-p", filepath.Join(projectPath, dir), filepath.Join(stagingPath, dir)); err != nil {
+			return false, fmt.Errorf("failed to create config directory: %w", err)
+		}
+	}
+
+	changed := false
+	for name, content := range files {
+		staged := filepath.Join(stagingPath, name)
+		if err := d.copyContent(ctx, content, staged); err != nil {
+			return false, fmt.Errorf("failed to copy %s to staging: %w", name, err)
+		}
+
+		if _, err := d.runCommand(ctx, "cmp", "-s", staged, filepath.Join(projectPath, name)); err != nil {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if err := d.validateProxyConfig(ctx, project, cfg, backend, projectPath, stagingPath); err != nil {
+		return false, err
+	}
+
+	for name := range files {
+		if _, err := d.runCommand(ctx, "mv", "-f", filepath.Join(stagingPath, name), filepath.Join(projectPath, name)); err != nil {
+			return false, fmt.Errorf("failed to move %s into place: %w", name, err)
+		}
+	}
+
+	return true, nil
+}
+
+func (d *Deployment) validateProxyConfig(ctx context.Context, project string, cfg *config.Config, backend proxy.Backend, projectPath, stagingPath string) error {
+	if _, err := d.pullImage(ctx, backend.Service(cfg, projectPath).Image); err != nil {
+		return fmt.Errorf("failed to pull proxy image: %w", err)
+	}
+
+	args := append([]string{"run", "--rm", "--network", project}, backend.ValidationArgs(cfg, projectPath, stagingPath)...)
+
+	output, err := d.executor.RunCommand(ctx, "docker", args...)
+	if err != nil {
+		var details []byte
+		if output != nil {
+			details, _ = io.ReadAll(output)
+		}
+		return fmt.Errorf("%s config validation failed: %w\n%s", backend.Name(), err, strings.TrimSpace(string(details)))
+	}
+
+	return nil
+}
+
+// installCertificate uploads the certificate FTL supplies for the project into the
+// folder the proxy mounts. It reports whether the installed pair changed.
+func (d *Deployment) installCertificate(ctx context.Context, cfg *config.Config, projectPath string) (bool, error) {
+	if !cfg.TLS.HasOwnCertificate() {
+		return false, nil
+	}
+
+	certPEM, keyPEM, err := certs.Obtain(ctx, cfg)
+	if err != nil {
+		return false, err
+	}
+
+	dir := filepath.Join(projectPath, proxy.CertificatesDir)
+	if _, err := d.runCommand(ctx, "mkdir", "-p", dir); err != nil {
+		return false, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	files := map[string]string{
+		cfg.Project.Domain + ".crt": string(certPEM),
+		cfg.Project.Domain + ".key": string(keyPEM),
+	}
+
+	changed := false
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		current, err := d.runCommand(ctx, "cat", path)
+		if err == nil && current == strings.TrimSpace(content) {
+			continue
+		}
+
+		// The file is created under a restrictive umask, so the key is never
+		// readable by others, not even before it's moved in place. The path is
+		// passed as an argument rather than in the script, so it's never parsed
+		// by the shell.
+		if err := d.executor.StreamCommand(ctx, strings.NewReader(content), nil,
+			"sh", "-c", `umask 077 && cat > "$1.tmp" && mv -f "$1.tmp" "$1"`, "sh", path); err != nil {
+			return false, fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+
+		changed = true
+	}
+
+	return changed, nil
+}
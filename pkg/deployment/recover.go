@@ -0,0 +1,153 @@
+package deployment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+)
+
+// reconcileService repairs what an interrupted update can leave behind, so the
+// deploy continues from a single container that carries the service alias:
+//
+//   - a stale new container next to a working old one is removed;
+//   - a new container that already took over the alias replaces the old one,
+//     which is detached if both still serve the alias. The new container of a
+//     worker has the alias from the start, so it's always treated as stale;
+//   - a new container left without an old one is promoted;
+//   - a container that lost its alias gets it back;
+//   - the old container kept by an interrupted recreate is started again when
+//     it has no replacement, and removed otherwise.
+func (d *Deployment) reconcileService(ctx context.Context, project string, svc *config.Service) error {
+	service := svc.Name
+	newName := service + newContainerSuffix
+	oldName := service + oldContainerSuffix
+
+	current, err := d.inspectContainer(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	old, err := d.inspectContainer(ctx, oldName)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case old == nil:
+	case current == nil:
+		console.Warning(fmt.Sprintf("Restoring container %s left by an interrupted recreate", oldName))
+		if _, err := d.runCommand(ctx, "docker", "rename", oldName, service); err != nil {
+			return fmt.Errorf("failed to rename old container: %w", err)
+		}
+		if _, err := d.runCommand(ctx, "docker", "start", service); err != nil {
+			return fmt.Errorf("failed to start old container: %w", err)
+		}
+		current = old
+	default:
+		console.Warning(fmt.Sprintf("Removing container %s left by an interrupted recreate", oldName))
+		if _, err := d.runCommand(ctx, "docker", "rm", "-f", oldName); err != nil {
+			return fmt.Errorf("failed to remove old container: %w", err)
+		}
+	}
+
+	next, err := d.inspectContainer(ctx, newName)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case next == nil:
+	case current != nil && (svc.IsWorker() || !next.hasAlias(project, service)):
+		console.Warning(fmt.Sprintf("Removing container %s left by an interrupted update", newName))
+		if _, err := d.runCommand(ctx, "docker", "rm", "-f", newName); err != nil {
+			return fmt.Errorf("failed to remove stale container: %w", err)
+		}
+	case next.hasAlias(project, service):
+		console.Warning(fmt.Sprintf("Completing interrupted update of %s", service))
+		if current != nil {
+			if current.connectedTo(project) {
+				if _, err := d.runCommand(ctx, "docker", "network", "disconnect", project, current.ID); err != nil {
+					return fmt.Errorf("failed to detach old container: %w", err)
+				}
+			}
+			if _, err := d.runCommand(ctx, "docker", "rm", "-f", current.ID); err != nil {
+				return fmt.Errorf("failed to remove old container: %w", err)
+			}
+		}
+		if _, err := d.runCommand(ctx, "docker", "rename", newName, service); err != nil {
+			return fmt.Errorf("failed to rename new container: %w", err)
+		}
+		return nil
+	default:
+		console.Warning(fmt.Sprintf("Promoting container %s left by an interrupted update", newName))
+		if err := d.attachAlias(ctx, project, next, service); err != nil {
+			return err
+		}
+		if _, err := d.runCommand(ctx, "docker", "rename", newName, service); err != nil {
+			return fmt.Errorf("failed to rename new container: %w", err)
+		}
+		return nil
+	}
+
+	if current != nil && !current.hasAlias(project, service) {
+		console.Warning(fmt.Sprintf("Reattaching %s to network %s", service, project))
+		return d.attachAlias(ctx, project, current, service)
+	}
+
+	return nil
+}
+
+// inspectContainer returns the container with the given name, or nil when there's
+// none.
+func (d *Deployment) inspectContainer(ctx context.Context, name string) (*containerInfo, error) {
+	output, err := d.runCommand(ctx, "docker", "ps", "-a", "--format", "{{.Names}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	if !contains(strings.Fields(output), name) {
+		return nil, nil
+	}
+
+	inspectOutput, err := d.runCommand(ctx, "docker", "inspect", "--type", "container", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+
+	var containerInfos []containerInfo
+	if err := json.Unmarshal([]byte(inspectOutput), &containerInfos); err != nil || len(containerInfos) == 0 {
+		return nil, fmt.Errorf("failed to decode container %s: %v", name, err)
+	}
+
+	return &containerInfos[0], nil
+}
+
+// attachAlias connects the container to the network under alias, reconnecting it
+// if it's attached without one.
+func (d *Deployment) attachAlias(ctx context.Context, network string, container *containerInfo, alias string) error {
+	if container.connectedTo(network) {
+		if _, err := d.runCommand(ctx, "docker", "network", "disconnect", network, container.ID); err != nil {
+			return fmt.Errorf("failed to detach container: %w", err)
+		}
+	}
+
+	if _, err := d.runCommand(ctx, "docker", "network", "connect", "--alias", alias, network, container.ID); err != nil {
+		return fmt.Errorf("failed to attach container: %w", err)
+	}
+
+	return nil
+}
+
+func (c *containerInfo) connectedTo(network string) bool {
+	_, ok := c.NetworkSettings.Networks[network]
+	return ok
+}
+
+func (c *containerInfo) hasAlias(network, alias string) bool {
+	settings, ok := c.NetworkSettings.Networks[network]
+	return ok && contains(settings.Aliases, alias)
+}
@@ -0,0 +1,250 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+// dockerStub answers the docker commands that inspect containers from a fixed set
+// of containers and records the commands that change them. Copied files are kept
+// in files, from which ls and cat answer. Streamed commands fail with streamErr
+// when it's set, and commands starting with a key of failures are recorded and
+// fail with its error. Inspected containers are passed through inspect when it's
+// set.
+type dockerStub struct {
+	containers map[string]map[string][]string // name -> network -> aliases
+	changes    []string
+	files      map[string]string
+	streamErr  error
+	failures   map[string]error
+	inspect    func(info *containerInfo)
+}
+
+func (s *dockerStub) RunCommand(_ context.Context, command string, args ...string) (io.Reader, error) {
+	line := strings.Join(append([]string{command}, args...), " ")
+
+	for prefix, err := range s.failures {
+		if strings.HasPrefix(line, prefix) {
+			s.changes = append(s.changes, line)
+			return nil, err
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(line, "docker ps"):
+		var names []string
+		for name := range s.containers {
+			names = append(names, name)
+		}
+		return strings.NewReader(strings.Join(names, "\n")), nil
+	case strings.HasPrefix(line, "docker inspect"):
+		name := args[len(args)-1]
+		info := containerInfo{ID: name}
+		info.Config.Image = name + ":latest"
+		info.State.Running = true
+		info.NetworkSettings.Networks = map[string]struct{ Aliases []string }{}
+		for network, aliases := range s.containers[name] {
+			info.NetworkSettings.Networks[network] = struct{ Aliases []string }{Aliases: aliases}
+		}
+		if s.inspect != nil {
+			s.inspect(&info)
+		}
+		output, err := json.Marshal([]containerInfo{info})
+		return bytes.NewReader(output), err
+	case strings.HasPrefix(line, "docker pull"):
+		return strings.NewReader(""), nil
+	case strings.HasPrefix(line, "docker image inspect"):
+		return strings.NewReader("sha256:1234\n"), nil
+	case strings.HasPrefix(line, "docker"):
+		s.changes = append(s.changes, line)
+		return strings.NewReader(""), nil
+	case line == "sh -c echo $HOME":
+		return strings.NewReader("/home/ftl\n"), nil
+	case strings.HasPrefix(line, "sh -c ls -1r "):
+		dir := strings.Fields(args[1])[2]
+		var names []string
+		for path := range s.files {
+			if filepath.Dir(path) == dir {
+				names = append(names, filepath.Base(path))
+			}
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+		return strings.NewReader(strings.Join(names, "\n")), nil
+	case command == "cat":
+		return strings.NewReader(s.files[args[0]]), nil
+	case command == "mkdir", command == "rm", command == "mv":
+		return strings.NewReader(""), nil
+	}
+
+	return nil, fmt.Errorf("unexpected command: %s", line)
+}
+
+func (s *dockerStub) CopyFile(_ context.Context, src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if s.files == nil {
+		s.files = make(map[string]string)
+	}
+	s.files[dst] = string(content)
+	return nil
+}
+
+// StreamCommand records the command along with its input, and writes "archive"
+// to out or fails with streamErr.
+func (s *dockerStub) StreamCommand(_ context.Context, in io.Reader, out io.Writer, command string, args ...string) error {
+	line := strings.Join(append([]string{command}, args...), " ")
+	if in != nil {
+		input, _ := io.ReadAll(in)
+		line += " < " + string(input)
+	}
+	s.changes = append(s.changes, line)
+	if s.streamErr != nil {
+		return s.streamErr
+	}
+
+	if out != nil {
+		_, _ = io.WriteString(out, "archive")
+	}
+	return nil
+}
+
+func TestReconcileService(t *testing.T) {
+	tests := []struct {
+		name       string
+		kind       string
+		containers map[string]map[string][]string
+		expected   []string
+	}{
+		{
+			name:       "healthy service",
+			containers: map[string]map[string][]string{"web": {"app": {"web"}}},
+		},
+		{
+			name:       "not installed",
+			containers: map[string]map[string][]string{},
+		},
+		{
+			name: "stale new container",
+			containers: map[string]map[string][]string{
+				"web":     {"app": {"web"}},
+				"web_new": {"app": {"web_new"}},
+			},
+			expected: []string{"docker rm -f web_new"},
+		},
+		{
+			name: "both containers attached",
+			containers: map[string]map[string][]string{
+				"web":     {"app": {"web"}},
+				"web_new": {"app": {"web"}},
+			},
+			expected: []string{
+				"docker network disconnect app web",
+				"docker rm -f web",
+				"docker rename web_new web",
+			},
+		},
+		{
+			name: "old container detached",
+			containers: map[string]map[string][]string{
+				"web":     {},
+				"web_new": {"app": {"web"}},
+			},
+			expected: []string{
+				"docker rm -f web",
+				"docker rename web_new web",
+			},
+		},
+		{
+			name: "only new container",
+			containers: map[string]map[string][]string{
+				"web_new": {"app": {"web_new"}},
+			},
+			expected: []string{
+				"docker network disconnect app web_new",
+				"docker network connect --alias web app web_new",
+				"docker rename web_new web",
+			},
+		},
+		{
+			name: "stale new worker container",
+			kind: "worker",
+			containers: map[string]map[string][]string{
+				"web":     {"app": {"web"}},
+				"web_new": {"app": {"web"}},
+			},
+			expected: []string{"docker rm -f web_new"},
+		},
+		{
+			name:       "service without alias",
+			containers: map[string]map[string][]string{"web": {}},
+			expected:   []string{"docker network connect --alias web app web"},
+		},
+		{
+			name: "stale new container and service without alias",
+			containers: map[string]map[string][]string{
+				"web":     {},
+				"web_new": {"app": {"web_new"}},
+			},
+			expected: []string{
+				"docker rm -f web_new",
+				"docker network connect --alias web app web",
+			},
+		},
+		{
+			name:       "old container of an interrupted recreate",
+			containers: map[string]map[string][]string{"web_old": {"app": {"web"}}},
+			expected: []string{
+				"docker rename web_old web",
+				"docker start web",
+			},
+		},
+		{
+			name: "old container next to its replacement",
+			containers: map[string]map[string][]string{
+				"web":     {"app": {"web"}},
+				"web_old": {"app": {"web"}},
+			},
+			expected: []string{"docker rm -f web_old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &dockerStub{containers: tt.containers}
+			deploy := NewDeployment(stub)
+
+			service := &config.Service{Name: "web", Kind: tt.kind}
+			require.NoError(t, deploy.reconcileService(context.Background(), "app", service))
+			assert.Equal(t, tt.expected, stub.changes)
+		})
+	}
+}
+
+func TestRollbackContainer(t *testing.T) {
+	stub := &dockerStub{}
+	deploy := NewDeployment(stub)
+
+	deploy.rollbackContainer(context.Background(), "web_new")
+	assert.Empty(t, stub.changes, "a failure that isn't a cancellation keeps the container")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	deploy.rollbackContainer(ctx, "web_new")
+	assert.Equal(t, []string{"docker rm -f web_new"}, stub.changes)
+}
@@ -0,0 +1,147 @@
+package deployment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+const (
+	releasesDir = "releases"
+
+	// releasesKept is how many release records are kept on a server.
+	releasesKept = 100
+)
+
+// Release records the images the services ran after a deploy, so what ran on a
+// server at a given time can be audited later.
+type Release struct {
+	ID         string           `json:"id"`
+	DeployedAt time.Time        `json:"deployed_at"`
+	DeployedBy string           `json:"deployed_by"`
+	Revision   string           `json:"revision,omitempty"`
+	Services   []ReleaseService `json:"services"`
+}
+
+// ReleaseService is a service as it ran after the deploy. Image is the reference
+// the container was started from, pinned to a digest unless the deploy ran with
+// --no-pin, and ImageID identifies the exact image on the server.
+type ReleaseService struct {
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	ImageID string `json:"image_id"`
+}
+
+// recordRelease writes the release to the releases folder of the project, named
+// by its ID so they sort by time, and prunes all but the last releasesKept.
+func (d *Deployment) recordRelease(ctx context.Context, project string, cfg *config.Config) error {
+	info := newLockInfo()
+	release := Release{
+		ID:         releaseID(info.AcquiredAt),
+		DeployedAt: info.AcquiredAt,
+		DeployedBy: info.Owner + "@" + info.Host,
+		Revision:   d.Revision,
+	}
+
+	for _, service := range cfg.Services {
+		container, err := d.inspectContainer(ctx, service.Name)
+		if err != nil {
+			return err
+		}
+		if container == nil {
+			continue
+		}
+
+		release.Services = append(release.Services, ReleaseService{
+			Name:    service.Name,
+			Image:   container.Config.Image,
+			ImageID: container.Image,
+		})
+	}
+
+	content, err := json.MarshalIndent(release, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode release: %w", err)
+	}
+
+	dir, err := d.releasesFolder(ctx, project)
+	if err != nil {
+		return err
+	}
+	if _, err := d.runCommand(ctx, "mkdir", "-p", dir); err != nil {
+		return fmt.Errorf("failed to create releases folder: %w", err)
+	}
+
+	if err := d.copyContent(ctx, string(content)+"\n", filepath.Join(dir, release.ID+".json")); err != nil {
+		return fmt.Errorf("failed to write release: %w", err)
+	}
+
+	if _, err := d.runCommand(ctx, "sh", "-c",
+		fmt.Sprintf("ls -1r %s/*.json | tail -n +%d | xargs -r rm -f", dir, releasesKept+1)); err != nil {
+		return fmt.Errorf("failed to prune releases: %w", err)
+	}
+
+	return nil
+}
+
+// releaseID names a release after the time it was deployed, down to the
+// millisecond, with a random suffix so deploys in the same instant don't
+// overwrite each other's record. IDs sort by time.
+func releaseID(deployedAt time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+
+	return deployedAt.Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// Releases returns the last limit releases recorded on the server, newest first.
+func (d *Deployment) Releases(ctx context.Context, project string, limit int) ([]Release, error) {
+	dir, err := d.releasesFolder(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := d.runCommand(ctx, "sh", "-c", "ls -1r "+dir+" 2>/dev/null || true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	var releases []Release
+	for _, name := range strings.Fields(output) {
+		if len(releases) == limit {
+			break
+		}
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		content, err := d.runCommand(ctx, "cat", filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read release %s: %w", name, err)
+		}
+
+		var release Release
+		if err := json.Unmarshal([]byte(content), &release); err != nil {
+			return nil, fmt.Errorf("failed to decode release %s: %w", name, err)
+		}
+		releases = append(releases, release)
+	}
+
+	return releases, nil
+}
+
+func (d *Deployment) releasesFolder(ctx context.Context, project string) (string, error) {
+	projectPath, err := d.projectFolder(ctx, project)
+	if err != nil {
+		return "", fmt.Errorf("failed to get project folder: %w", err)
+	}
+
+	return filepath.Join(projectPath, releasesDir), nil
+}
@@ -0,0 +1,44 @@
+package deployment
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestReleases(t *testing.T) {
+	stub := &dockerStub{containers: map[string]map[string][]string{"web": {"app": {"web"}}}}
+	deploy := NewDeployment(stub)
+	deploy.Revision = "0f3c2a1b9e4d"
+	ctx := context.Background()
+
+	releases, err := deploy.Releases(ctx, "app", 10)
+	require.NoError(t, err)
+	assert.Empty(t, releases)
+
+	cfg := &config.Config{Services: []config.Service{{Name: "web"}, {Name: "worker"}}}
+	require.NoError(t, deploy.recordRelease(ctx, "app", cfg))
+
+	releases, err = deploy.Releases(ctx, "app", 10)
+	require.NoError(t, err)
+	require.Len(t, releases, 1)
+
+	release := releases[0]
+	assert.True(t, strings.HasPrefix(release.ID, release.DeployedAt.Format("20060102T150405.000Z-")), release.ID)
+	assert.NotEmpty(t, release.DeployedBy)
+	assert.Equal(t, "0f3c2a1b9e4d", release.Revision)
+	assert.Equal(t, []ReleaseService{{Name: "web", Image: "web:latest"}}, release.Services,
+		"services without a container are left out")
+	assert.Contains(t, stub.files, "/home/ftl/projects/app/releases/"+release.ID+".json")
+
+	require.NoError(t, deploy.recordRelease(ctx, "app", cfg))
+	require.NoError(t, deploy.recordRelease(ctx, "app", cfg))
+	releases, err = deploy.Releases(ctx, "app", 10)
+	require.NoError(t, err)
+	assert.Len(t, releases, 3, "releases recorded in the same instant are all kept")
+}
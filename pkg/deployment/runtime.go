@@ -0,0 +1,106 @@
+package deployment
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+// runtimeArgs returns the "docker run" flags for the runtime options. The command
+// and the arguments of the entrypoint go after the image and are left to the caller.
+func runtimeArgs(runtime *config.Runtime) []string {
+	restart := runtime.Restart
+	if restart == "" {
+		restart = config.DefaultRestartPolicy
+	}
+	args := []string{"--restart", restart}
+
+	if runtime.Memory != "" {
+		args = append(args, "--memory", runtime.Memory)
+	}
+
+	if runtime.CPUs != "" {
+		args = append(args, "--cpus", runtime.CPUs)
+	}
+
+	if runtime.User != "" {
+		args = append(args, "--user", runtime.User)
+	}
+
+	if len(runtime.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", runtime.Entrypoint[0])
+	}
+
+	for _, name := range sortedKeys(runtime.Ulimits) {
+		args = append(args, "--ulimit", fmt.Sprintf("%s=%s", name, runtime.Ulimits[name]))
+	}
+
+	for _, capability := range runtime.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+
+	for _, capability := range runtime.CapDrop {
+		args = append(args, "--cap-drop", capability)
+	}
+
+	if runtime.ReadOnly {
+		args = append(args, "--read-only")
+	}
+
+	for _, tmpfs := range runtime.Tmpfs {
+		args = append(args, "--tmpfs", tmpfs)
+	}
+
+	for _, key := range sortedKeys(runtime.Labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, runtime.Labels[key]))
+	}
+
+	if runtime.Logging != nil {
+		args = append(args, "--log-driver", runtime.Logging.Driver)
+		for _, key := range sortedKeys(runtime.Logging.Options) {
+			args = append(args, "--log-opt", fmt.Sprintf("%s=%s", key, runtime.Logging.Options[key]))
+		}
+	}
+
+	return args
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// mountArg returns the value of a "docker run --mount" flag. Named volumes are
+// scoped to the project, and relative paths are resolved against projectPath.
+func mountArg(project, projectPath string, mount config.Mount) string {
+	fields := []string{"type=" + mount.Type}
+
+	switch mount.Type {
+	case config.MountVolume:
+		fields = append(fields, "source="+volumeName(project, mount.Source))
+	case config.MountBind:
+		source := mount.Source
+		if mount.IsRelative() {
+			source = filepath.Join(projectPath, source)
+		}
+		fields = append(fields, "source="+source)
+	}
+
+	fields = append(fields, "target="+mount.Target)
+	if mount.ReadOnly {
+		fields = append(fields, "readonly")
+	}
+	if mount.Size != "" {
+		fields = append(fields, "tmpfs-size="+mount.Size)
+	}
+
+	return strings.Join(fields, ",")
+}
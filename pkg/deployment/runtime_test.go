@@ -0,0 +1,83 @@
+package deployment
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestRuntimeArgs(t *testing.T) {
+	assert.Equal(t, []string{"--restart", "unless-stopped"}, runtimeArgs(&config.Runtime{}))
+
+	runtime := &config.Runtime{
+		Restart:    "on-failure:5",
+		Memory:     "512m",
+		CPUs:       "1.5",
+		User:       "1000:1000",
+		Entrypoint: []string{"/docker-entrypoint.sh", "--verbose"},
+		Ulimits:    map[string]string{"nproc": "512", "nofile": "1024:65536"},
+		CapAdd:     []string{"NET_ADMIN"},
+		CapDrop:    []string{"ALL"},
+		ReadOnly:   true,
+		Tmpfs:      []string{"/tmp", "/run:size=64m"},
+		Labels:     map[string]string{"team": "payments", "com.example.tier": "backend"},
+		Logging: &config.Logging{
+			Driver:  "json-file",
+			Options: map[string]string{"max-size": "10m", "max-file": "3"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"--restart", "on-failure:5",
+		"--memory", "512m",
+		"--cpus", "1.5",
+		"--user", "1000:1000",
+		"--entrypoint", "/docker-entrypoint.sh",
+		"--ulimit", "nofile=1024:65536",
+		"--ulimit", "nproc=512",
+		"--cap-add", "NET_ADMIN",
+		"--cap-drop", "ALL",
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--tmpfs", "/run:size=64m",
+		"--label", "com.example.tier=backend",
+		"--label", "team=payments",
+		"--log-driver", "json-file",
+		"--log-opt", "max-file=3",
+		"--log-opt", "max-size=10m",
+	}, runtimeArgs(runtime))
+}
+
+func TestMountArg(t *testing.T) {
+	tests := []struct {
+		mount    config.Mount
+		expected string
+	}{
+		{
+			mount:    config.Mount{Type: config.MountVolume, Source: "uploads", Target: "/app/uploads"},
+			expected: "type=volume,source=my-project-uploads,target=/app/uploads",
+		},
+		{
+			mount:    config.Mount{Type: config.MountVolume, Source: "2024_data", Target: "/data", ReadOnly: true},
+			expected: "type=volume,source=my-project-2024_data,target=/data,readonly",
+		},
+		{
+			mount:    config.Mount{Type: config.MountBind, Source: "./config/app.yml", Target: "/app/config.yml", ReadOnly: true},
+			expected: "type=bind,source=/home/ftl/projects/my-project/config/app.yml,target=/app/config.yml,readonly",
+		},
+		{
+			mount:    config.Mount{Type: config.MountBind, Source: "/var/log/web", Target: "/app/log"},
+			expected: "type=bind,source=/var/log/web,target=/app/log",
+		},
+		{
+			mount:    config.Mount{Type: config.MountTmpfs, Target: "/app/tmp", Size: "64m"},
+			expected: "type=tmpfs,target=/app/tmp,tmpfs-size=64m",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, mountArg("my-project", "/home/ftl/projects/my-project", tt.mount))
+	}
+}
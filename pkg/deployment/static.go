@@ -0,0 +1,390 @@
+package deployment
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/proxy"
+)
+
+// SyncStatic uploads the build directory of a static site as a new release and
+// points the site's current symlink at it. The symlink is swapped with a rename,
+// so the proxy never serves a half-uploaded release. Releases with the same
+// content are reused instead of uploaded again.
+func (d *Deployment) SyncStatic(ctx context.Context, project string, static *config.Static) (string, error) {
+	archive, digest, err := archiveDirectory(static.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to archive %s: %w", static.Path, err)
+	}
+	defer os.Remove(archive)
+
+	siteDir, err := d.staticFolder(ctx, project, static.Name)
+	if err != nil {
+		return "", err
+	}
+
+	releases, current, err := d.staticReleases(ctx, siteDir)
+	if err != nil {
+		return "", err
+	}
+
+	release := ""
+	for _, existing := range releases {
+		if strings.HasSuffix(existing, "-"+digest) {
+			release = existing
+		}
+	}
+
+	if release == "" {
+		release = time.Now().UTC().Format("20060102150405.000000") + "-" + digest
+		releasePath := filepath.Join(siteDir, "releases", release)
+		upload := filepath.Join(siteDir, "upload.tar.gz")
+
+		if err := d.executor.CopyFile(ctx, archive, upload); err != nil {
+			return "", fmt.Errorf("failed to upload release: %w", err)
+		}
+
+		commands := [][]string{
+			{"mkdir", "-p", releasePath},
+			{"tar", "-xzf", upload, "-C", releasePath},
+			{"rm", "-f", upload},
+		}
+		for _, cmd := range commands {
+			if _, err := d.runCommand(ctx, cmd[0], cmd[1:]...); err != nil {
+				_, _ = d.runCommand(ctx, "rm", "-rf", releasePath, upload)
+				return "", fmt.Errorf("failed to unpack release: %w", err)
+			}
+		}
+
+		releases = append(releases, release)
+	}
+
+	if release != current {
+		if err := d.activateStaticRelease(ctx, siteDir, release); err != nil {
+			return "", err
+		}
+	}
+
+	if err := d.pruneStaticReleases(ctx, siteDir, releases, release, static.Keep); err != nil {
+		return "", err
+	}
+
+	return release, nil
+}
+
+// RollbackStatic points a static site back at an earlier release. With an empty
+// target it goes back to the release that was active before the current one, and
+// further back on each call.
+func (d *Deployment) RollbackStatic(ctx context.Context, project, name, target string) (string, error) {
+	if err := d.AcquireLock(ctx, project, d.LockWait); err != nil {
+		return "", fmt.Errorf("failed to acquire deploy lock: %w", err)
+	}
+	defer d.releaseLock(ctx, project)
+
+	siteDir, err := d.staticFolder(ctx, project, name)
+	if err != nil {
+		return "", err
+	}
+
+	releases, current, err := d.staticReleases(ctx, siteDir)
+	if err != nil {
+		return "", err
+	}
+
+	if target != "" {
+		if !contains(releases, target) {
+			return "", fmt.Errorf("release %s not found", target)
+		}
+		if err := d.activateStaticRelease(ctx, siteDir, target); err != nil {
+			return "", err
+		}
+		return target, nil
+	}
+
+	history, err := d.staticHistory(ctx, siteDir)
+	if err != nil {
+		return "", err
+	}
+	if len(history) == 0 {
+		// Sites deployed before the history was kept go back by release name.
+		for _, release := range releases {
+			if release < current {
+				history = append(history, release)
+			}
+		}
+		history = append(history, current)
+	}
+
+	// Walk back from the current release, skipping releases that were pruned.
+	i := len(history) - 1
+	for i >= 0 && history[i] == current {
+		i--
+	}
+	for i >= 0 && !contains(releases, history[i]) {
+		i--
+	}
+	if i < 0 {
+		return "", fmt.Errorf("no release before %s to roll back to", current)
+	}
+	target = history[i]
+
+	if err := d.switchStaticRelease(ctx, siteDir, target); err != nil {
+		return "", err
+	}
+	if err := d.writeStaticHistory(ctx, siteDir, history[:i+1]); err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+func (d *Deployment) staticFolder(ctx context.Context, project, name string) (string, error) {
+	projectPath, err := d.prepareProjectFolder(ctx, project)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare project folder: %w", err)
+	}
+
+	siteDir := filepath.Join(projectPath, proxy.StaticDir, name)
+	if _, err := d.runCommand(ctx, "mkdir", "-p", filepath.Join(siteDir, "releases")); err != nil {
+		return "", fmt.Errorf("failed to create static folder: %w", err)
+	}
+
+	return siteDir, nil
+}
+
+// staticReleases returns the releases of a static site, oldest first, along with
+// the one currently served. Release names start with a UTC timestamp, so they
+// sort chronologically.
+func (d *Deployment) staticReleases(ctx context.Context, siteDir string) ([]string, string, error) {
+	output, err := d.runCommand(ctx, "ls", "-1", filepath.Join(siteDir, "releases"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	var releases []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			releases = append(releases, line)
+		}
+	}
+	sort.Strings(releases)
+
+	current := ""
+	if target, err := d.runCommand(ctx, "readlink", filepath.Join(siteDir, "current")); err == nil {
+		current = filepath.Base(target)
+	}
+
+	return releases, current, nil
+}
+
+// activateStaticRelease points the site at the release and adds it to the
+// activation history, along which RollbackStatic goes back.
+func (d *Deployment) activateStaticRelease(ctx context.Context, siteDir, release string) error {
+	if err := d.switchStaticRelease(ctx, siteDir, release); err != nil {
+		return err
+	}
+
+	history, err := d.staticHistory(ctx, siteDir)
+	if err != nil {
+		return err
+	}
+
+	history = append(history, release)
+	if len(history) > staticHistoryLimit {
+		history = history[len(history)-staticHistoryLimit:]
+	}
+
+	return d.writeStaticHistory(ctx, siteDir, history)
+}
+
+func (d *Deployment) switchStaticRelease(ctx context.Context, siteDir, release string) error {
+	link := filepath.Join(siteDir, "current")
+
+	commands := [][]string{
+		{"ln", "-sfn", filepath.Join("releases", release), link + ".tmp"},
+		{"mv", "-Tf", link + ".tmp", link},
+	}
+	for _, cmd := range commands {
+		if _, err := d.runCommand(ctx, cmd[0], cmd[1:]...); err != nil {
+			return fmt.Errorf("failed to activate release %s: %w", release, err)
+		}
+	}
+
+	return nil
+}
+
+// staticHistoryLimit is how many activations of a static site are remembered.
+const staticHistoryLimit = 100
+
+// staticHistory returns the releases of a static site in the order they were
+// activated, the current one last.
+func (d *Deployment) staticHistory(ctx context.Context, siteDir string) ([]string, error) {
+	path := filepath.Join(siteDir, "history")
+	if _, err := d.runCommand(ctx, "test", "-f", path); err != nil {
+		return nil, nil
+	}
+
+	output, err := d.runCommand(ctx, "cat", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read release history: %w", err)
+	}
+
+	return strings.Fields(output), nil
+}
+
+func (d *Deployment) writeStaticHistory(ctx context.Context, siteDir string, history []string) error {
+	path := filepath.Join(siteDir, "history")
+	if err := d.copyContent(ctx, strings.Join(history, "\n")+"\n", path); err != nil {
+		return fmt.Errorf("failed to write release history: %w", err)
+	}
+
+	return nil
+}
+
+// pruneStaticReleases removes the releases that were active the longest time ago
+// so that at most keep remain, never touching the active one. Releases missing
+// from the history go first, oldest first.
+func (d *Deployment) pruneStaticReleases(ctx context.Context, siteDir string, releases []string, active string, keep int) error {
+	history, err := d.staticHistory(ctx, siteDir)
+	if err != nil {
+		return err
+	}
+
+	lastActive := make(map[string]int)
+	for i, release := range history {
+		lastActive[release] = i + 1
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		if lastActive[releases[i]] != lastActive[releases[j]] {
+			return lastActive[releases[i]] < lastActive[releases[j]]
+		}
+		return releases[i] < releases[j]
+	})
+
+	excess := len(releases) - keep
+	for _, release := range releases {
+		if excess <= 0 {
+			break
+		}
+		if release == active {
+			continue
+		}
+		if _, err := d.runCommand(ctx, "rm", "-rf", filepath.Join(siteDir, "releases", release)); err != nil {
+			return fmt.Errorf("failed to remove release %s: %w", release, err)
+		}
+		excess--
+	}
+
+	return nil
+}
+
+// archiveDirectory packs dir into a temporary tar.gz file and returns its path
+// together with a short digest of the directory's content.
+func archiveDirectory(dir string) (string, string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		return "", "", fmt.Errorf("%s is not a directory", dir)
+	}
+
+	file, err := os.CreateTemp("", "ftl-static-*.tar.gz")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	hash := sha256.New()
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%s\x00", header.Name, link)
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(io.MultiWriter(tarWriter, hash), src)
+		return err
+	})
+
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", "", err
+	}
+
+	return file.Name(), hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,103 @@
+package deployment
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+func TestSyncStatic(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+
+	buildDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(buildDir, "assets"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "index.html"), []byte("v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "assets", "app.js"), []byte("console.log(1)"), 0644))
+
+	deploy := NewDeployment(&LocalExecutor{})
+	static := &config.Static{Name: "frontend", Path: buildDir, PathPrefix: "/", Keep: 2}
+	siteDir := filepath.Join(os.Getenv("HOME"), "projects", "test-project", "static", "frontend")
+
+	first, err := deploy.SyncStatic(ctx, "test-project", static)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(siteDir, "current", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+	assert.FileExists(t, filepath.Join(siteDir, "current", "assets", "app.js"))
+
+	again, err := deploy.SyncStatic(ctx, "test-project", static)
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "unchanged content should reuse the release")
+
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "index.html"), []byte("v2"), 0644))
+	second, err := deploy.SyncStatic(ctx, "test-project", static)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	content, err = os.ReadFile(filepath.Join(siteDir, "current", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(content))
+
+	release, err := deploy.RollbackStatic(ctx, "test-project", "frontend", "")
+	require.NoError(t, err)
+	assert.Equal(t, first, release)
+
+	content, err = os.ReadFile(filepath.Join(siteDir, "current", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(content))
+
+	_, err = deploy.RollbackStatic(ctx, "test-project", "frontend", "")
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(buildDir, "index.html"), []byte("v3"), 0644))
+	_, err = deploy.SyncStatic(ctx, "test-project", static)
+	require.NoError(t, err)
+
+	releases, err := os.ReadDir(filepath.Join(siteDir, "releases"))
+	require.NoError(t, err)
+	assert.Len(t, releases, 2)
+}
+
+func TestRollbackStatic_ReusedRelease(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := context.Background()
+
+	buildDir := t.TempDir()
+	deploy := NewDeployment(&LocalExecutor{})
+	static := &config.Static{Name: "frontend", Path: buildDir, PathPrefix: "/", Keep: 5}
+	siteDir := filepath.Join(os.Getenv("HOME"), "projects", "test-project", "static", "frontend")
+
+	sync := func(content string) string {
+		require.NoError(t, os.WriteFile(filepath.Join(buildDir, "index.html"), []byte(content), 0644))
+		release, err := deploy.SyncStatic(ctx, "test-project", static)
+		require.NoError(t, err)
+		return release
+	}
+
+	a := sync("A")
+	b := sync("B")
+	assert.Equal(t, a, sync("A"), "content deployed before reuses its release")
+
+	release, err := deploy.RollbackStatic(ctx, "test-project", "frontend", "")
+	require.NoError(t, err)
+	assert.Equal(t, b, release)
+
+	content, err := os.ReadFile(filepath.Join(siteDir, "current", "index.html"))
+	require.NoError(t, err)
+	assert.Equal(t, "B", string(content))
+
+	release, err = deploy.RollbackStatic(ctx, "test-project", "frontend", "")
+	require.NoError(t, err)
+	assert.Equal(t, a, release)
+
+	_, err = deploy.RollbackStatic(ctx, "test-project", "frontend", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,243 @@
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yarlson/ftl/pkg/config"
+	"github.com/yarlson/ftl/pkg/console"
+)
+
+const (
+	backupsDir = "backups"
+
+	// volumeHelperImage runs tar against a volume in a throwaway container, so
+	// backups don't depend on the tools in the service images.
+	volumeHelperImage = "alpine:3"
+)
+
+// VolumeInfo describes a named volume of the project on a server.
+type VolumeInfo struct {
+	Name string
+	// Created is false for volumes in the config that don't exist on the server yet.
+	Created bool
+	// Size is the disk usage in bytes, or -1 when it couldn't be measured.
+	Size int64
+	// Containers is the number of containers that mount the volume.
+	Containers int
+}
+
+// volumeName is the Docker volume backing a volume of the project.
+func volumeName(project, volume string) string {
+	return fmt.Sprintf("%s-%s", project, volume)
+}
+
+// ListVolumes returns the given volumes of the project with their size. The sizes
+// are measured with du in a helper container that mounts the volumes read-only,
+// since docker system df prints them rounded for people to read.
+func (d *Deployment) ListVolumes(ctx context.Context, project string, volumes []config.Volume) ([]VolumeInfo, error) {
+	output, err := d.runCommand(ctx, "docker", "volume", "ls", "--format", "{{.Name}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for _, name := range strings.Fields(output) {
+		existing[name] = true
+	}
+
+	infos := make([]VolumeInfo, len(volumes))
+	args := []string{"run", "--rm"}
+	var paths []string
+	for i, volume := range volumes {
+		infos[i] = VolumeInfo{Name: volume.Name, Size: -1}
+		name := volumeName(project, volume.Name)
+		if !existing[name] {
+			continue
+		}
+		infos[i].Created = true
+
+		output, err := d.runCommand(ctx, "docker", "ps", "-aq", "--filter", "volume="+name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find containers using volume %s: %w", volume.Name, err)
+		}
+		infos[i].Containers = len(strings.Fields(output))
+
+		path := "/volumes/" + volume.Name
+		args = append(args, "--mount", mountArg(project, "", config.Mount{Type: config.MountVolume, Source: volume.Name, Target: path, ReadOnly: true}))
+		paths = append(paths, path)
+	}
+
+	if len(paths) == 0 {
+		return infos, nil
+	}
+
+	// A volume that can't be measured keeps its size unknown rather than failing
+	// the whole list.
+	output, err = d.runCommand(ctx, "docker", append(append(args, volumeHelperImage, "du", "-sk"), paths...)...)
+	if err != nil {
+		return infos, nil
+	}
+
+	sizes := parseDiskUsage(output)
+	for i := range infos {
+		if size, ok := sizes[infos[i].Name]; ok {
+			infos[i].Size = size
+		}
+	}
+
+	return infos, nil
+}
+
+// BackupVolume writes a gzipped tar of the volume to w. The volume is read while
+// its containers keep running, so files being written at the time may be caught
+// half-way.
+func (d *Deployment) BackupVolume(ctx context.Context, project, volume string, w io.Writer) error {
+	name := volumeName(project, volume)
+	if _, err := d.runCommand(ctx, "docker", "volume", "inspect", name); err != nil {
+		return fmt.Errorf("volume %s does not exist", volume)
+	}
+
+	mount := config.Mount{Type: config.MountVolume, Source: volume, Target: "/volume", ReadOnly: true}
+	if err := d.executor.StreamCommand(ctx, nil, w, "docker", "run", "--rm", "--mount", mountArg(project, "", mount),
+		volumeHelperImage, "tar", "-C", "/volume", "-czf", "-", "."); err != nil {
+		return fmt.Errorf("failed to back up volume %s: %w", volume, err)
+	}
+
+	return nil
+}
+
+// RestoreVolume replaces the content of the volume with the gzipped tar read from
+// r. The archive is extracted next to the current content first, so a truncated
+// or corrupt archive leaves the volume as it was. Only then are the containers
+// using the volume stopped, the content swapped and the containers started
+// again, whether the swap succeeded or not. The deploy lock is held throughout.
+func (d *Deployment) RestoreVolume(ctx context.Context, project string, volume config.Volume, r io.Reader) error {
+	if err := d.AcquireLock(ctx, project, d.LockWait); err != nil {
+		return fmt.Errorf("failed to acquire deploy lock: %w", err)
+	}
+	defer d.releaseLock(ctx, project)
+
+	if err := d.createVolume(ctx, project, volume); err != nil {
+		return err
+	}
+
+	mount := mountArg(project, "", config.Mount{Type: config.MountVolume, Source: volume.Name, Target: "/volume"})
+
+	if err := d.executor.StreamCommand(ctx, r, nil, "docker", "run", "--rm", "-i", "--mount", mount, volumeHelperImage,
+		"sh", "-c", extractScript); err != nil {
+		return fmt.Errorf("failed to restore volume %s: the volume was left unchanged: %w", volume.Name, err)
+	}
+
+	name := volumeName(project, volume.Name)
+	output, err := d.runCommand(ctx, "docker", "ps", "-q", "--filter", "volume="+name)
+	if err != nil {
+		return fmt.Errorf("failed to find containers using volume %s: %w", volume.Name, err)
+	}
+	containers := strings.Fields(output)
+
+	// Once the containers are stopped, the swap is completed and they're started
+	// again even if the restore is cancelled.
+	ctx = context.WithoutCancel(ctx)
+
+	if len(containers) > 0 {
+		if _, err := d.runCommand(ctx, "docker", append([]string{"stop"}, containers...)...); err != nil {
+			return fmt.Errorf("failed to stop containers using volume %s: %w", volume.Name, err)
+		}
+		defer func() {
+			if _, err := d.runCommand(ctx, "docker", append([]string{"start"}, containers...)...); err != nil {
+				console.Warning(fmt.Sprintf("Failed to start containers using volume %s: %v", volume.Name, err))
+			}
+		}()
+	}
+
+	if _, err := d.runCommand(ctx, "docker", "run", "--rm", "--mount", mount, volumeHelperImage,
+		"sh", "-c", swapScript); err != nil {
+		return fmt.Errorf("failed to restore volume %s: %w", volume.Name, err)
+	}
+
+	return nil
+}
+
+// restoreDir holds an extracted backup inside the volume until it replaces the
+// content. Being on the same filesystem, the swap only renames files.
+const restoreDir = "/volume/.ftl-restore"
+
+var (
+	// extractScript extracts the archive on stdin into restoreDir, and removes
+	// what it extracted when tar fails.
+	extractScript = fmt.Sprintf("rm -rf %[1]s && mkdir %[1]s && tar -C %[1]s -xzf - || { rm -rf %[1]s; exit 1; }", restoreDir)
+
+	// swapScript replaces the content of the volume with the extracted archive.
+	swapScript = fmt.Sprintf(`find /volume -mindepth 1 -maxdepth 1 ! -name %[2]s -exec rm -rf {} \; && `+
+		`find %[1]s -mindepth 1 -maxdepth 1 -exec mv {} /volume/ \; && rmdir %[1]s`, restoreDir, filepath.Base(restoreDir))
+)
+
+// scheduledJobs returns the jobs of the project along with a job for every volume
+// backup. Backups are kept in backups/<volume> of the project folder.
+func (d *Deployment) scheduledJobs(ctx context.Context, project string, cfg *config.Config) ([]config.Job, error) {
+	if len(cfg.Backups) == 0 {
+		return cfg.Jobs, nil
+	}
+
+	projectPath, err := d.prepareProjectFolder(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare project folder: %w", err)
+	}
+
+	jobs := append([]config.Job{}, cfg.Jobs...)
+	for _, backup := range cfg.Backups {
+		dir := filepath.Join(projectPath, backupsDir, backup.Volume)
+		if _, err := d.runCommand(ctx, "mkdir", "-p", dir); err != nil {
+			return nil, fmt.Errorf("failed to create backup folder: %w", err)
+		}
+
+		jobs = append(jobs, backupJob(backup, dir))
+	}
+
+	return jobs, nil
+}
+
+// backupJob archives the volume into dir under a timestamped name and removes all
+// but the last backup.Keep archives. The archive is written under a temporary
+// name first, so a failed run never replaces a good backup.
+func backupJob(backup config.Backup, dir string) config.Job {
+	script := fmt.Sprintf(`file=/backups/$(date -u +%%Y%%m%%dT%%H%%M%%SZ).tar.gz && `+
+		`tar -C /volume -czf "$file.tmp" . && mv "$file.tmp" "$file" && `+
+		`ls -1r /backups/*.tar.gz | tail -n +%d | xargs -r rm -f`, backup.Keep+1)
+
+	return config.Job{
+		Name:     backup.JobName(),
+		Schedule: backup.Schedule,
+		Image:    volumeHelperImage,
+		Command:  []string{"sh", "-c", script},
+		Volumes: []config.Mount{
+			{Type: config.MountVolume, Source: backup.Volume, Target: "/volume", ReadOnly: true},
+			{Type: config.MountBind, Source: dir, Target: "/backups"},
+		},
+	}
+}
+
+// parseDiskUsage reads the output of du -sk for the volumes mounted under
+// /volumes and returns their sizes in bytes by volume name.
+func parseDiskUsage(output string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		kilobytes, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes[filepath.Base(fields[1])] = kilobytes * 1024
+	}
+
+	return sizes
+}
@@ -0,0 +1,111 @@
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+// outputStub answers the commands starting with a key of outputs with its value,
+// and leaves the others to dockerStub.
+type outputStub struct {
+	dockerStub
+	outputs map[string]string
+}
+
+func (s *outputStub) RunCommand(ctx context.Context, command string, args ...string) (io.Reader, error) {
+	line := strings.Join(append([]string{command}, args...), " ")
+	for prefix, output := range s.outputs {
+		if strings.HasPrefix(line, prefix) {
+			return strings.NewReader(output), nil
+		}
+	}
+
+	return s.dockerStub.RunCommand(ctx, command, args...)
+}
+
+func TestListVolumes(t *testing.T) {
+	stub := &outputStub{outputs: map[string]string{
+		"docker volume ls": "my-project-db_data\nmy-project-uploads\nother-uploads\n",
+		"docker ps -aq --filter volume=my-project-db_data":      "3f2a9c1b7d4e\n",
+		"docker ps -aq --filter volume=my-project-uploads":      "",
+		"docker run --rm --mount type=volume,source=my-project": "1028\t/volumes/db_data\n4\t/volumes/uploads\n",
+	}}
+	deploy := NewDeployment(stub)
+
+	volumes, err := deploy.ListVolumes(context.Background(), "my-project", []config.Volume{{Name: "db_data"}, {Name: "uploads"}, {Name: "cache"}})
+	require.NoError(t, err)
+	assert.Equal(t, []VolumeInfo{
+		{Name: "db_data", Created: true, Size: 1028 * 1024, Containers: 1},
+		{Name: "uploads", Created: true, Size: 4 * 1024},
+		{Name: "cache", Size: -1},
+	}, volumes)
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	assert.Equal(t, map[string]int64{"db_data": 1052672, "uploads": 4096},
+		parseDiskUsage("1028\t/volumes/db_data\n4\t/volumes/uploads\n"))
+	assert.Empty(t, parseDiskUsage("du: /volumes/cache: No such file or directory\n"))
+}
+
+func TestBackupVolume(t *testing.T) {
+	stub := &dockerStub{}
+	deploy := NewDeployment(stub)
+
+	var archive bytes.Buffer
+	require.NoError(t, deploy.BackupVolume(context.Background(), "my-project", "db_data", &archive))
+	assert.Equal(t, "archive", archive.String())
+	assert.Equal(t, []string{
+		"docker volume inspect my-project-db_data",
+		"docker run --rm --mount type=volume,source=my-project-db_data,target=/volume,readonly alpine:3 tar -C /volume -czf - .",
+	}, stub.changes)
+}
+
+func TestRestoreVolume(t *testing.T) {
+	stub := &dockerStub{containers: map[string]map[string][]string{"postgres": {"my-project": {"postgres"}}}}
+	deploy := NewDeployment(stub)
+
+	require.NoError(t, deploy.RestoreVolume(context.Background(), "my-project", config.Volume{Name: "db_data"}, strings.NewReader("backup")))
+	assert.Equal(t, []string{
+		"docker volume inspect my-project-db_data",
+		"docker run --rm -i --mount type=volume,source=my-project-db_data,target=/volume alpine:3 sh -c " + extractScript + " < backup",
+		"docker stop postgres",
+		"docker run --rm --mount type=volume,source=my-project-db_data,target=/volume alpine:3 sh -c " + swapScript,
+		"docker start postgres",
+	}, stub.changes)
+}
+
+func TestRestoreVolume_BadArchive(t *testing.T) {
+	stub := &dockerStub{
+		containers: map[string]map[string][]string{"postgres": {"my-project": {"postgres"}}},
+		streamErr:  errors.New("gzip: stdin: unexpected end of file"),
+	}
+	deploy := NewDeployment(stub)
+
+	err := deploy.RestoreVolume(context.Background(), "my-project", config.Volume{Name: "db_data"}, strings.NewReader("truncated"))
+	require.ErrorContains(t, err, "the volume was left unchanged")
+	assert.Equal(t, []string{
+		"docker volume inspect my-project-db_data",
+		"docker run --rm -i --mount type=volume,source=my-project-db_data,target=/volume alpine:3 sh -c " + extractScript + " < truncated",
+	}, stub.changes)
+}
+
+func TestBackupJob(t *testing.T) {
+	job := backupJob(config.Backup{Volume: "db_data", Schedule: "0 2 * * *", Keep: 3}, "/home/ftl/projects/my-project/backups/db_data")
+
+	assert.Equal(t, "backup-db_data", job.Name)
+	assert.Equal(t, "0 2 * * *", job.Schedule)
+	assert.Equal(t, mounts("db_data:/volume:ro", "/home/ftl/projects/my-project/backups/db_data:/backups"), job.Volumes)
+	require.Len(t, job.Command, 3)
+	assert.Equal(t, []string{"sh", "-c"}, job.Command[:2])
+	assert.Contains(t, job.Command[2], "$(date -u +%Y%m%dT%H%M%SZ)")
+	assert.Contains(t, job.Command[2], "tail -n +4 ")
+}
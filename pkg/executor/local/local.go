@@ -26,6 +26,18 @@ func (e *Executor) RunCommand(ctx context.Context, command string, args ...strin
 	return bytes.NewReader(output), nil
 }
 
+// RunCommandWithOutput runs the command and writes its combined output to out as
+// it's produced, so long-running commands such as builds can be followed.
+func (e *Executor) RunCommandWithOutput(ctx context.Context, out io.Writer, command string, args ...string) error {
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command execution failed: %w", err)
+	}
+	return nil
+}
+
 func (e *Executor) RunCommandWithProgress(ctx context.Context, initialMsg, completeMsg string, commands []string) error {
 	operations := make([]func() error, len(commands))
 	for i, cmdString := range commands {
@@ -16,6 +16,20 @@ import (
 	"github.com/yarlson/ftl/pkg/console"
 )
 
+// ConnectionError is returned when a server can't be reached or doesn't accept the key.
+type ConnectionError struct {
+	Host string
+	Err  error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("failed to establish SSH connection to %s: %v", e.Host, e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
 type Client struct {
 	sshClient *ssh.Client
 	config    *ssh.ClientConfig
@@ -144,6 +158,57 @@ func (c *Client) RunCommand(ctx context.Context, command string, args ...string)
 	return bytes.NewReader(output.Bytes()), nil
 }
 
+// StreamCommand runs a command with its stdin read from in and its stdout written
+// to out, for payloads too large to buffer such as volume archives. Either may be
+// nil. Stderr is kept for the error. Arguments are passed verbatim, so they may
+// hold credentials with shell metacharacters.
+func (c *Client) StreamCommand(ctx context.Context, in io.Reader, out io.Writer, command string, args ...string) error {
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+
+	session, err := c.sshClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("unable to create session: %v", err)
+	}
+	defer session.Close()
+
+	fullCommand := command
+	for _, arg := range args {
+		fullCommand += " '" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	var stderr bytes.Buffer
+	session.Stdin = in
+	session.Stdout = out
+	session.Stderr = &stderr
+
+	if err := session.Start(fullCommand); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		_ = session.Close()
+		return ctx.Err()
+	case err := <-done:
+		if err != nil {
+			if message := strings.TrimSpace(stderr.String()); message != "" {
+				return fmt.Errorf("command failed: %w: %s", err, message)
+			}
+			return fmt.Errorf("command failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func (c *Client) CopyFile(ctx context.Context, src, dst string) error {
 	if err := c.ensureConnected(); err != nil {
 		return err
@@ -265,7 +330,7 @@ func FindKeyAndConnectWithUser(host string, port int, user, keyPath string) (*Cl
 
 	client, err := ConnectWithUser(host, port, user, key)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to establish SSH connection: %w", err)
+		return nil, nil, &ConnectionError{Host: host, Err: err}
 	}
 
 	return client, key, nil
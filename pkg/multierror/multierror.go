@@ -0,0 +1,71 @@
+// Package multierror collects failures of independent operations, such as
+// deploying to several servers, so they can be reported together.
+package multierror
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Failure is an error attributed to the server, service or other target it
+// occurred on.
+type Failure struct {
+	Target string
+	Err    error
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("%s: %v", f.Target, f.Err)
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Error aggregates failures. The zero value is ready to use.
+type Error struct {
+	Failures []*Failure
+}
+
+// Add records err against target. A nil err is ignored.
+func (e *Error) Add(target string, err error) {
+	if err == nil {
+		return
+	}
+
+	e.Failures = append(e.Failures, &Failure{Target: target, Err: err})
+}
+
+// ErrorOrNil returns e when it holds any failures and nil otherwise, so that an
+// empty Error doesn't turn into a non-nil error interface.
+func (e *Error) ErrorOrNil() error {
+	if e == nil || len(e.Failures) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+func (e *Error) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Error()
+	}
+
+	lines := make([]string, 0, len(e.Failures)+1)
+	lines = append(lines, fmt.Sprintf("%d failures:", len(e.Failures)))
+	for _, failure := range e.Failures {
+		lines = append(lines, "  "+failure.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap exposes the individual failures to errors.Is and errors.As.
+func (e *Error) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure
+	}
+
+	return errs
+}
@@ -0,0 +1,29 @@
+package multierror
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	var errs Error
+	assert.NoError(t, errs.ErrorOrNil())
+
+	errs.Add("server a", nil)
+	assert.NoError(t, errs.ErrorOrNil())
+
+	errs.Add("server a", errors.New("connection refused"))
+	assert.EqualError(t, errs.ErrorOrNil(), "server a: connection refused")
+
+	errs.Add("server b", io.ErrUnexpectedEOF)
+	err := errs.ErrorOrNil()
+	assert.EqualError(t, err, "2 failures:\n  server a: connection refused\n  server b: unexpected EOF")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	var failure *Failure
+	assert.ErrorAs(t, err, &failure)
+	assert.Equal(t, "server a", failure.Target)
+}
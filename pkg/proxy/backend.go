@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+// CertificatesDir is the folder, relative to the project folder, where FTL puts
+// certificates it supplies to the proxy.
+const CertificatesDir = "certs"
+
+// StaticDir is the folder, relative to the project folder, that holds the
+// releases of static sites. Each site keeps its releases under
+// <name>/releases and serves the one the <name>/current symlink points to.
+const StaticDir = "static"
+
+// Backend is a reverse proxy implementation that FTL can deploy in front of the
+// project's services.
+type Backend interface {
+	// Name returns the proxy type as used in the config.
+	Name() string
+
+	// Service returns the container definition of the proxy. Config files are
+	// expected under projectPath, where Render places them.
+	Service(cfg *config.Config, projectPath string) *config.Service
+
+	// Render returns every configuration file keyed by its path relative to the
+	// project folder.
+	Render(cfg *config.Config) (map[string]string, error)
+
+	// ValidationArgs returns the arguments for "docker run" that check the
+	// configuration rendered into stagingPath in a throwaway proxy container.
+	ValidationArgs(cfg *config.Config, projectPath, stagingPath string) []string
+
+	// ReloadCommand returns the command run inside the proxy container to pick up
+	// a changed configuration or certificate.
+	ReloadCommand() []string
+
+	// CertificatePaths returns where the proxy container reads the certificate
+	// and key from.
+	CertificatePaths(cfg *config.Config) (string, string)
+}
+
+// customize applies the overrides from the proxy section of the config to the
+// container definition built by a backend.
+func customize(service *config.Service, cfg *config.Config) *config.Service {
+	proxyCfg := cfg.Proxy
+	httpPort, httpsPort := proxyCfg.Ports()
+
+	forwards := []string{
+		publish(proxyCfg.BindAddress, httpPort, 80, "tcp"),
+		publish(proxyCfg.BindAddress, httpsPort, 443, "tcp"),
+	}
+	for _, svc := range cfg.Services {
+		if svc.IsStream() {
+			forwards = append(forwards, publish(proxyCfg.BindAddress, svc.PublicPort, svc.PublicPort, svc.Protocol))
+		}
+	}
+	service.Forwards = forwards
+
+	if proxyCfg.Image != "" {
+		service.Image = proxyCfg.Image
+	}
+
+	service.Volumes = append(service.Volumes, proxyCfg.Volumes...)
+
+	if len(proxyCfg.EnvVars) > 0 {
+		if service.EnvVars == nil {
+			service.EnvVars = make(map[string]string)
+		}
+		for key, value := range proxyCfg.EnvVars {
+			service.EnvVars[key] = value
+		}
+	}
+
+	service.Memory = proxyCfg.Memory
+	service.CPUs = proxyCfg.CPUs
+
+	if proxyCfg.HealthCheck != nil {
+		service.HealthCheck = proxyCfg.HealthCheck
+	}
+
+	return service
+}
+
+// bind mounts a path on the server into the proxy container.
+func bind(source, target string, readOnly bool) config.Mount {
+	return config.Mount{Type: config.MountBind, Source: source, Target: target, ReadOnly: readOnly}
+}
+
+func publish(bindAddress string, hostPort, containerPort int, protocol string) string {
+	forward := fmt.Sprintf("%d:%d", hostPort, containerPort)
+	if bindAddress != "" {
+		forward = bindAddress + ":" + forward
+	}
+	if protocol != "tcp" {
+		forward += "/" + protocol
+	}
+
+	return forward
+}
+
+// NewBackend returns the proxy backend selected in the config.
+func NewBackend(cfg *config.Config) (Backend, error) {
+	switch cfg.Proxy.Type {
+	case "", "nginx":
+		return &Nginx{}, nil
+	case "caddy":
+		return &Caddy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown proxy type %q", cfg.Proxy.Type)
+	}
+}
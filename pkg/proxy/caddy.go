@@ -0,0 +1,267 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+const (
+	caddyImage     = "caddy:2"
+	caddyConfigDir = "caddy"
+	caddyProjectFS = "/ftl"
+)
+
+// Caddy is a proxy backend for teams that prefer Caddy's automatic HTTPS. TCP/UDP
+// services and rate limiting need Caddy plugins and are rejected by config validation.
+type Caddy struct{}
+
+func (c *Caddy) Name() string {
+	return "caddy"
+}
+
+// Service returns the Caddy container. It has no health check, since the image
+// doesn't ship curl.
+func (c *Caddy) Service(cfg *config.Config, projectPath string) *config.Service {
+	return customize(&config.Service{
+		Name:  "proxy",
+		Image: caddyImage,
+		Port:  80,
+		Volumes: []config.Mount{
+			bind(filepath.Join(projectPath, caddyConfigDir), "/etc/caddy", false),
+			bind(projectPath, caddyProjectFS, true),
+			{Type: config.MountVolume, Source: "caddy_data", Target: "/data"},
+			{Type: config.MountVolume, Source: "caddy_config", Target: "/config"},
+		},
+	}, cfg)
+}
+
+func (c *Caddy) Render(cfg *config.Config) (map[string]string, error) {
+	caddyfile, err := GenerateCaddyfile(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Caddyfile: %w", err)
+	}
+
+	return map[string]string{
+		filepath.Join(caddyConfigDir, "Caddyfile"): strings.TrimSpace(caddyfile),
+	}, nil
+}
+
+func (c *Caddy) ValidationArgs(cfg *config.Config, projectPath, stagingPath string) []string {
+	return []string{
+		"-v", filepath.Join(stagingPath, caddyConfigDir) + ":/etc/caddy:ro",
+		"-v", projectPath + ":" + caddyProjectFS + ":ro",
+		c.Service(cfg, projectPath).Image,
+		"caddy", "validate", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile",
+	}
+}
+
+// ReloadCommand forces the reload, because Caddy skips reloading an unchanged
+// config even when the certificate files behind it were replaced.
+func (c *Caddy) ReloadCommand() []string {
+	return []string{"caddy", "reload", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile", "--force"}
+}
+
+func (c *Caddy) CertificatePaths(cfg *config.Config) (string, string) {
+	dir := caddyProjectFS + "/" + CertificatesDir
+	return fmt.Sprintf("%s/%s.crt", dir, cfg.Project.Domain), fmt.Sprintf("%s/%s.key", dir, cfg.Project.Domain)
+}
+
+// GenerateCaddyfile generates a Caddyfile based on the provided config.
+func GenerateCaddyfile(cfg *config.Config) (string, error) {
+	if cfg.Project.Domain == "" {
+		cfg.Project.Domain = "localhost"
+	}
+
+	tmpl := template.Must(template.New("caddy").Funcs(templateFuncs).Funcs(template.FuncMap{
+		"ownCertificate": func(cfg *config.Config) bool { return cfg.TLS.HasOwnCertificate() },
+		"caddyCertificate": func(cfg *config.Config) string {
+			certificate, key := (&Caddy{}).CertificatePaths(cfg)
+			return certificate + " " + key
+		},
+		"siteAddress":  caddySiteAddress,
+		"caddyPath":    caddyPath,
+		"caddySize":    caddySize,
+		"caddyTimeout": caddyTimeout,
+		"deniedIPs":    caddyDeniedMatcher,
+		"caddyStaticRoot": func(name string) string {
+			return caddyProjectFS + "/" + StaticDir + "/" + name + "/current"
+		},
+	}).Parse(`
+{
+	email {{.Project.Email}}
+}
+
+{{siteAddress .}} {
+{{- if ownCertificate .}}
+	tls {{caddyCertificate .}}
+{{- end}}
+{{- if .Proxy.Snippet}}
+{{indent .Proxy.Snippet 1}}
+{{- end}}
+{{- range .Services}}
+	{{- $service := .}}
+	{{- range .Routes}}
+
+	handle {{caddyPath .PathPrefix}} {
+		{{- if and .StripPrefix (ne .PathPrefix "/")}}
+		uri strip_prefix {{.PathPrefix}}
+		{{- end}}
+		{{- with deniedIPs .Allow .Deny}}
+		@denied {{.}}
+		respond @denied 403
+		{{- end}}
+		{{- if .BasicAuth}}
+		basic_auth bcrypt {{quote (or .BasicAuth.Realm "Restricted")}} {
+		{{- range .BasicAuth.Users}}
+			{{replace . ":" " "}}
+		{{- end}}
+		}
+		{{- end}}
+		{{- if .ClientMaxBodySize}}
+		request_body {
+			max_size {{caddySize .ClientMaxBodySize}}
+		}
+		{{- end}}
+		{{- range $name, $value := .ResponseHeaders}}
+		header {{$name}} {{quote $value}}
+		{{- end}}
+		{{- if .Snippet}}
+{{indent .Snippet 2}}
+		{{- end}}
+		reverse_proxy {{$service.Name}}:{{$service.Port}}
+		{{- if or .RequestHeaders .ProxyReadTimeout}} {
+		{{- range $name, $value := .RequestHeaders}}
+			header_up {{$name}} {{quote $value}}
+		{{- end}}
+		{{- if .ProxyReadTimeout}}
+			transport http {
+				read_timeout {{caddyTimeout .ProxyReadTimeout}}
+			}
+		{{- end}}
+		}
+		{{- end}}
+	}
+	{{- end}}
+{{- end}}
+{{- range .Static}}
+
+	handle {{caddyPath .PathPrefix}} {
+		{{- if ne .PathPrefix "/"}}
+		uri strip_prefix {{.PathPrefix}}
+		{{- end}}
+		root * {{caddyStaticRoot .Name}}
+		@{{.Name}}_pages path_regexp (^|/)[^./]*$|\.html$
+		@{{.Name}}_assets not path_regexp (^|/)[^./]*$|\.html$
+		header @{{.Name}}_pages Cache-Control "no-cache"
+		header @{{.Name}}_assets Cache-Control "public, max-age={{seconds .CacheMaxAge}}"
+		{{- if .SPA}}
+		try_files {path} /index.html
+		{{- end}}
+		file_server
+	}
+{{- end}}
+}
+`))
+
+	var buffer bytes.Buffer
+	err := tmpl.Execute(&buffer, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+func caddySiteAddress(cfg *config.Config) string {
+	if wildcard(cfg) {
+		return cfg.Project.Domain + ", *." + cfg.Project.Domain
+	}
+
+	return cfg.Project.Domain
+}
+
+// caddyPath turns an nginx location prefix into a Caddy path matcher. Caddy sorts
+// handle blocks by path length, so the most specific route wins as in nginx.
+func caddyPath(prefix string) string {
+	return prefix + "*"
+}
+
+// caddySize converts an nginx size such as 10m into Caddy's 10MB.
+func caddySize(size string) string {
+	units := map[string]string{"k": "KB", "m": "MB", "g": "GB"}
+
+	suffix := strings.ToLower(size[len(size)-1:])
+	if unit, ok := units[suffix]; ok {
+		return size[:len(size)-1] + unit
+	}
+
+	return size
+}
+
+var nginxTimePart = regexp.MustCompile(`([0-9]+)(ms|s|m|h|d|w|M|y)?`)
+
+// caddyTimeout converts an nginx time such as 1h30m or 2d into a Go duration.
+func caddyTimeout(value string) string {
+	units := map[string]time.Duration{
+		"ms": time.Millisecond,
+		"":   time.Second,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+		"M":  30 * 24 * time.Hour,
+		"y":  365 * 24 * time.Hour,
+	}
+
+	var total time.Duration
+	for _, part := range nginxTimePart.FindAllStringSubmatch(value, -1) {
+		n, _ := strconv.Atoi(part[1])
+		total += time.Duration(n) * units[part[2]]
+	}
+
+	return total.String()
+}
+
+// caddyDeniedMatcher mirrors nginx's allow-then-deny evaluation: a request is
+// rejected when it matches no allow entry but does match a deny entry.
+func caddyDeniedMatcher(allow, deny []string) string {
+	var allowed, denied []string
+	denyAll := false
+
+	for _, entry := range allow {
+		if entry == "all" {
+			return ""
+		}
+		allowed = append(allowed, entry)
+	}
+
+	for _, entry := range deny {
+		if entry == "all" {
+			denyAll = true
+			continue
+		}
+		denied = append(denied, entry)
+	}
+
+	switch {
+	case denyAll && len(allowed) == 0:
+		return "path *"
+	case denyAll:
+		return "not remote_ip " + strings.Join(allowed, " ")
+	case len(denied) == 0:
+		return ""
+	case len(allowed) == 0:
+		return "remote_ip " + strings.Join(denied, " ")
+	default:
+		return fmt.Sprintf("{\n\t\t\tnot remote_ip %s\n\t\t\tremote_ip %s\n\t\t}", strings.Join(allowed, " "), strings.Join(denied, " "))
+	}
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yarlson/ftl/pkg/config"
+)
+
+const (
+	nginxImage           = "yarlson/zero-nginx:latest"
+	nginxConfigDir       = "nginx"
+	nginxStreamConfigDir = "nginx-stream"
+	nginxMainConfig      = "nginx.conf"
+	nginxStaticRoot      = "/srv/static"
+)
+
+// Nginx is the default proxy backend. It runs yarlson/zero-nginx, which obtains
+// certificates over HTTP-01 by itself.
+type Nginx struct{}
+
+func (n *Nginx) Name() string {
+	return "nginx"
+}
+
+func (n *Nginx) Service(cfg *config.Config, projectPath string) *config.Service {
+	volumes := []config.Mount{
+		bind(projectPath+"/", "/etc/nginx/ssl", false),
+		bind(filepath.Join(projectPath, nginxConfigDir), "/etc/nginx/conf.d", false),
+	}
+
+	if HasStreamServices(cfg) {
+		volumes = append(volumes,
+			bind(filepath.Join(projectPath, nginxStreamConfigDir), "/etc/nginx/stream.d", false),
+			bind(filepath.Join(projectPath, nginxMainConfig), "/etc/nginx/nginx.conf", false),
+		)
+	}
+
+	if len(cfg.Static) > 0 {
+		volumes = append(volumes, bind(filepath.Join(projectPath, StaticDir), nginxStaticRoot, true))
+	}
+
+	return customize(&config.Service{
+		Name:    "proxy",
+		Image:   nginxImage,
+		Port:    80,
+		Volumes: volumes,
+		EnvVars: map[string]string{
+			"DOMAIN": cfg.Project.Domain,
+			"EMAIL":  cfg.Project.Email,
+		},
+		HealthCheck: &config.HealthCheck{
+			Path:     "/",
+			Interval: time.Second,
+			Timeout:  time.Second,
+			Retries:  30,
+		},
+	}, cfg)
+}
+
+func (n *Nginx) Render(cfg *config.Config) (map[string]string, error) {
+	nginxConfig, err := GenerateNginxConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nginx config: %w", err)
+	}
+
+	files := map[string]string{
+		filepath.Join(nginxConfigDir, "default.conf"): strings.TrimSpace(nginxConfig),
+	}
+
+	for name, content := range GenerateHtpasswdFiles(cfg) {
+		files[filepath.Join(nginxConfigDir, name)] = content
+	}
+
+	if HasStreamServices(cfg) {
+		streamConfig, err := GenerateNginxStreamConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate nginx stream config: %w", err)
+		}
+
+		files[filepath.Join(nginxStreamConfigDir, "stream.conf")] = strings.TrimSpace(streamConfig)
+		files[nginxMainConfig] = strings.TrimSpace(GenerateNginxMainConfig())
+	}
+
+	return files, nil
+}
+
+// ValidationArgs runs nginx -t against the staged configuration. The live
+// certificates are copied into the throwaway container, and a short-lived
+// self-signed pair stands in for them when they haven't been issued yet.
+func (n *Nginx) ValidationArgs(cfg *config.Config, projectPath, stagingPath string) []string {
+	certificate, key := n.CertificatePaths(cfg)
+	script := strings.Join([]string{
+		"mkdir -p /etc/nginx/ssl",
+		"cp /etc/nginx/ssl-live/*.crt /etc/nginx/ssl-live/*.key /etc/nginx/ssl/ 2>/dev/null",
+		"cp -r /etc/nginx/ssl-live/" + CertificatesDir + " /etc/nginx/ssl/ 2>/dev/null",
+		fmt.Sprintf("mkdir -p %s", filepath.Dir(certificate)),
+		fmt.Sprintf("[ -f %[1]s ] || openssl req -x509 -nodes -newkey rsa:2048 -days 1 -subj /CN=%[3]s -keyout %[2]s -out %[1]s >/dev/null 2>&1", certificate, key, cfg.Project.Domain),
+		"nginx -t",
+	}, "; ")
+
+	args := []string{
+		"-v", projectPath + ":/etc/nginx/ssl-live:ro",
+		"-v", filepath.Join(stagingPath, nginxConfigDir) + ":/etc/nginx/conf.d:ro",
+	}
+
+	if HasStreamServices(cfg) {
+		args = append(args,
+			"-v", filepath.Join(stagingPath, nginxStreamConfigDir)+":/etc/nginx/stream.d:ro",
+			"-v", filepath.Join(stagingPath, nginxMainConfig)+":/etc/nginx/nginx.conf:ro",
+		)
+	}
+
+	return append(args, "--entrypoint", "sh", n.Service(cfg, projectPath).Image, "-c", script)
+}
+
+func (n *Nginx) ReloadCommand() []string {
+	return []string{"nginx", "-s", "reload"}
+}
+
+// CertificatePaths returns where nginx reads the certificate and key from.
+// Certificates supplied by FTL live in a separate directory, so they never
+// collide with the ones zero-nginx obtains on its own.
+func (n *Nginx) CertificatePaths(cfg *config.Config) (string, string) {
+	dir := "/etc/nginx/ssl"
+	if cfg.TLS.HasOwnCertificate() {
+		dir = "/etc/nginx/ssl/" + CertificatesDir
+	}
+
+	return fmt.Sprintf("%s/%s.crt", dir, cfg.Project.Domain), fmt.Sprintf("%s/%s.key", dir, cfg.Project.Domain)
+}
@@ -2,8 +2,10 @@ package proxy
 
 import (
 	"bytes"
-	"html/template"
+	"fmt"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/yarlson/ftl/pkg/config"
 )
@@ -14,35 +16,93 @@ func GenerateNginxConfig(cfg *config.Config) (string, error) {
 		cfg.Project.Domain = "localhost"
 	}
 
-	tmpl := template.Must(template.New("nginx").Parse(`
+	tmpl := template.Must(template.New("nginx").Funcs(templateFuncs).Parse(`
+{{- if hasWebsockets .Services}}
+	map $http_upgrade $ftl_connection_upgrade {
+		default upgrade;
+		'' close;
+	}
+{{- end}}
+{{- range .Services}}
+	{{- $serviceName := .Name }}
+	{{- range $index, $route := .Routes}}
+	{{- if .RateLimit}}
+	limit_req_zone $binary_remote_addr zone={{routeID $serviceName $index}}:10m rate={{.RateLimit.Rate}};
+	{{- end}}
+	{{- end}}
+{{- end}}
+{{- range $index, $static := .Static}}
+	map $sent_http_content_type {{staticCacheVar $index}} {
+		default "public, max-age={{seconds .CacheMaxAge}}";
+		~^text/html "no-cache";
+	}
+{{- end}}
 {{- range .Services}}
+{{- if not (or .IsStream .IsWorker)}}
 	upstream {{.Name}} {
 		server {{.Name}}:{{.Port}};
 	}
+{{- end}}
 {{- end}}
 
 	server {
 		listen 80;
-		server_name {{.Project.Domain}};
-		return 301 https://$server_name$request_uri;
+		server_name {{serverNames .}};
+		return 301 https://{{if wildcard .}}$host{{else}}$server_name{{end}}$request_uri;
 	}
 
 	server {
 		listen 443 ssl;
 		http2 on;
-		server_name {{.Project.Domain}};
+		server_name {{serverNames .}};
 
-		ssl_certificate /etc/nginx/ssl/{{.Project.Domain}}.crt;
-		ssl_certificate_key /etc/nginx/ssl/{{.Project.Domain}}.key;
+		ssl_certificate {{certificatePath .}};
+		ssl_certificate_key {{keyPath .}};
 		ssl_protocols TLSv1.2 TLSv1.3;
 		ssl_prefer_server_ciphers on;
+{{- if .Proxy.Snippet}}
+{{indent .Proxy.Snippet 2}}
+{{- end}}
 
 {{- range .Services}}
 	{{- $serviceName := .Name }}
-	{{- range .Routes}}
+	{{- range $index, $route := .Routes}}
 		location {{.PathPrefix}} {
 		{{- if .StripPrefix}}
 			rewrite ^{{.PathPrefix}}(.*)$ /$1 break;
+		{{- end}}
+		{{- if .ClientMaxBodySize}}
+			client_max_body_size {{.ClientMaxBodySize}};
+		{{- end}}
+		{{- if .ProxyReadTimeout}}
+			proxy_read_timeout {{.ProxyReadTimeout}};
+		{{- end}}
+		{{- if .Websocket}}
+			proxy_http_version 1.1;
+			proxy_set_header Upgrade $http_upgrade;
+			proxy_set_header Connection $ftl_connection_upgrade;
+		{{- end}}
+		{{- range $name, $value := .RequestHeaders}}
+			proxy_set_header {{$name}} {{quote $value}};
+		{{- end}}
+		{{- range $name, $value := .ResponseHeaders}}
+			add_header {{$name}} {{quote $value}} always;
+		{{- end}}
+		{{- if .BasicAuth}}
+			auth_basic {{quote (or .BasicAuth.Realm "Restricted")}};
+			auth_basic_user_file /etc/nginx/conf.d/{{htpasswdFile $serviceName $index}};
+		{{- end}}
+		{{- range .Allow}}
+			allow {{.}};
+		{{- end}}
+		{{- range .Deny}}
+			deny {{.}};
+		{{- end}}
+		{{- if .RateLimit}}
+			limit_req zone={{routeID $serviceName $index}}{{if .RateLimit.Burst}} burst={{.RateLimit.Burst}}{{end}}{{if .RateLimit.NoDelay}} nodelay{{end}};
+		{{- end}}
+		{{- if .Snippet}}
+{{indent .Snippet 3}}
 		{{- end}}
 			resolver 127.0.0.11 valid=1s;
 			set $service {{$serviceName}};
@@ -50,7 +110,142 @@ func GenerateNginxConfig(cfg *config.Config) (string, error) {
 		}
 	{{- end}}
 {{- end}}
+{{- range $index, $static := .Static}}
+	{{- if eq .PathPrefix "/"}}
+
+		location / {
+			root {{staticRoot .Name}};
+	{{- else}}
+
+		location = {{trimSlash .PathPrefix}} {
+			return 301 {{trimSlash .PathPrefix}}/;
+		}
+
+		location {{trimSlash .PathPrefix}}/ {
+			alias {{staticRoot .Name}}/;
+	{{- end}}
+			try_files $uri $uri/ {{if .SPA}}{{trimSlash .PathPrefix}}/index.html{{else}}=404{{end}};
+			add_header Cache-Control {{staticCacheVar $index}} always;
+		}
+{{- end}}
+	}
+`))
+
+	var buffer bytes.Buffer
+	err := tmpl.Execute(&buffer, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ReplaceAll(buffer.String(), "\t", "    "), nil
+}
+
+// GenerateHtpasswdFiles returns the contents of the htpasswd files referenced by
+// routes with basic auth, keyed by file name relative to the nginx config directory.
+func GenerateHtpasswdFiles(cfg *config.Config) map[string]string {
+	files := make(map[string]string)
+
+	for _, service := range cfg.Services {
+		for index, route := range service.Routes {
+			if route.BasicAuth == nil {
+				continue
+			}
+			files[htpasswdFile(service.Name, index)] = strings.Join(route.BasicAuth.Users, "\n") + "\n"
+		}
+	}
+
+	return files
+}
+
+var templateFuncs = template.FuncMap{
+	"routeID":        routeID,
+	"htpasswdFile":   htpasswdFile,
+	"quote":          quote,
+	"indent":         indent,
+	"hasWebsockets":  hasWebsockets,
+	"replace":        func(s, from, to string) string { return strings.Replace(s, from, to, 1) },
+	"serverNames":    serverNames,
+	"wildcard":       wildcard,
+	"staticRoot":     func(name string) string { return nginxStaticRoot + "/" + name + "/current" },
+	"staticCacheVar": func(index int) string { return fmt.Sprintf("$ftl_static_cache_%d", index) },
+	"trimSlash":      func(prefix string) string { return strings.TrimRight(prefix, "/") },
+	"seconds":        func(d time.Duration) int64 { return int64(d.Seconds()) },
+	"certificatePath": func(cfg *config.Config) string {
+		certificate, _ := (&Nginx{}).CertificatePaths(cfg)
+		return certificate
+	},
+	"keyPath": func(cfg *config.Config) string {
+		_, key := (&Nginx{}).CertificatePaths(cfg)
+		return key
+	},
+}
+
+func wildcard(cfg *config.Config) bool {
+	return cfg.TLS.DNS != nil && cfg.TLS.DNS.Wildcard
+}
+
+func serverNames(cfg *config.Config) string {
+	if wildcard(cfg) {
+		return cfg.Project.Domain + " *." + cfg.Project.Domain
+	}
+
+	return cfg.Project.Domain
+}
+
+func routeID(service string, index int) string {
+	return fmt.Sprintf("%s-%d", service, index)
+}
+
+func htpasswdFile(service string, index int) string {
+	return routeID(service, index) + ".htpasswd"
+}
+
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func indent(snippet string, depth int) string {
+	lines := strings.Split(strings.TrimSpace(snippet), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Repeat("\t", depth) + strings.TrimRight(line, " \t")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func hasWebsockets(services []config.Service) bool {
+	for _, service := range services {
+		for _, route := range service.Routes {
+			if route.Websocket {
+				return true
+			}
+		}
 	}
+
+	return false
+}
+
+// GenerateNginxStreamConfig generates the Nginx stream block for services exposed
+// over raw TCP or UDP. It returns an empty string when there are no such services.
+func GenerateNginxStreamConfig(cfg *config.Config) (string, error) {
+	if !HasStreamServices(cfg) {
+		return "", nil
+	}
+
+	tmpl := template.Must(template.New("nginx-stream").Parse(`
+stream {
+	resolver 127.0.0.11 valid=1s;
+{{- range .Services}}
+{{- if .IsStream}}
+
+	server {
+		listen {{.PublicPort}}{{if eq .Protocol "udp"}} udp{{end}};
+		set $service {{.Name}}:{{.Port}};
+		proxy_pass $service;
+	}
+{{- end}}
+{{- end}}
+}
 `))
 
 	var buffer bytes.Buffer
@@ -61,3 +256,49 @@ func GenerateNginxConfig(cfg *config.Config) (string, error) {
 
 	return strings.ReplaceAll(buffer.String(), "\t", "    "), nil
 }
+
+// GenerateNginxMainConfig generates the top-level nginx.conf. It is only needed when
+// stream services are configured, because stream blocks can't live in conf.d, which
+// is included inside the http block.
+func GenerateNginxMainConfig() string {
+	return strings.ReplaceAll(`
+user nginx;
+worker_processes auto;
+
+error_log /var/log/nginx/error.log notice;
+pid /var/run/nginx.pid;
+
+events {
+	worker_connections 1024;
+}
+
+http {
+	include /etc/nginx/mime.types;
+	default_type application/octet-stream;
+
+	log_format main '$remote_addr - $remote_user [$time_local] "$request" '
+		'$status $body_bytes_sent "$http_referer" '
+		'"$http_user_agent" "$http_x_forwarded_for"';
+
+	access_log /var/log/nginx/access.log main;
+
+	sendfile on;
+	keepalive_timeout 65;
+
+	include /etc/nginx/conf.d/*.conf;
+}
+
+include /etc/nginx/stream.d/*.conf;
+`, "\t", "    ")
+}
+
+// HasStreamServices reports whether any service in the config is exposed as a TCP or UDP stream.
+func HasStreamServices(cfg *config.Config) bool {
+	for i := range cfg.Services {
+		if cfg.Services[i].IsStream() {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -117,6 +118,11 @@ func (suite *ProxyTestSuite) TestGenerateNginxConfig_MultipleServices() {
 					},
 				},
 			},
+			{
+				Name:  "consumer",
+				Image: "api:latest",
+				Kind:  "worker",
+			},
 		},
 	}
 
@@ -193,3 +199,505 @@ func (suite *ProxyTestSuite) TestGenerateNginxConfig_EmptyConfig() {
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), stripWhitespace(expectedConfig), stripWhitespace(nginxConfig))
 }
+
+func (suite *ProxyTestSuite) TestGenerateNginxStreamConfig() {
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		Services: []config.Service{
+			{
+				Name:     "web",
+				Image:    "nginx:latest",
+				Port:     80,
+				Protocol: "http",
+				Routes: []config.Route{
+					{
+						PathPrefix: "/",
+					},
+				},
+			},
+			{
+				Name:       "mqtt",
+				Image:      "eclipse-mosquitto:2",
+				Port:       1883,
+				Protocol:   "tcp",
+				PublicPort: 1883,
+			},
+			{
+				Name:       "dns",
+				Image:      "coredns/coredns:latest",
+				Port:       53,
+				Protocol:   "udp",
+				PublicPort: 5353,
+			},
+		},
+	}
+
+	expectedStreamConfig := `
+stream {
+    resolver 127.0.0.11 valid=1s;
+
+    server {
+        listen 1883;
+        set $service mqtt:1883;
+        proxy_pass $service;
+    }
+
+    server {
+        listen 5353 udp;
+        set $service dns:53;
+        proxy_pass $service;
+    }
+}
+`
+
+	streamConfig, err := GenerateNginxStreamConfig(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stripWhitespace(expectedStreamConfig), stripWhitespace(streamConfig))
+
+	nginxConfig, err := GenerateNginxConfig(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), nginxConfig, "upstream web {")
+	assert.NotContains(suite.T(), nginxConfig, "upstream mqtt")
+	assert.NotContains(suite.T(), nginxConfig, "upstream dns")
+}
+
+func (suite *ProxyTestSuite) TestGenerateNginxStreamConfig_NoStreamServices() {
+	cfg := &config.Config{
+		Services: []config.Service{
+			{
+				Name:  "web",
+				Image: "nginx:latest",
+				Port:  80,
+			},
+		},
+	}
+
+	streamConfig, err := GenerateNginxStreamConfig(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), streamConfig)
+}
+
+func (suite *ProxyTestSuite) TestGenerateNginxConfig_RouteOptions() {
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		Proxy: config.Proxy{
+			Snippet: "add_header X-Frame-Options DENY;",
+		},
+		Services: []config.Service{
+			{
+				Name:  "api",
+				Image: "api:latest",
+				Port:  8080,
+				Routes: []config.Route{
+					{
+						PathPrefix:        "/api",
+						ClientMaxBodySize: "50m",
+						ProxyReadTimeout:  "120s",
+						Websocket:         true,
+						RequestHeaders: map[string]string{
+							"X-Real-IP": "$remote_addr",
+						},
+						ResponseHeaders: map[string]string{
+							"Cache-Control": `no-store, "private"`,
+						},
+						BasicAuth: &config.BasicAuth{
+							Users: []string{"admin:$apr1$abc$xyz"},
+						},
+						Allow: []string{"10.0.0.0/8"},
+						Deny:  []string{"all"},
+						RateLimit: &config.RateLimit{
+							Rate:    "10r/s",
+							Burst:   20,
+							NoDelay: true,
+						},
+						Snippet: "if ($request_method = OPTIONS) {\n    return 204;\n}",
+					},
+				},
+			},
+		},
+	}
+
+	expectedConfig := `
+    map $http_upgrade $ftl_connection_upgrade {
+        default upgrade;
+        '' close;
+    }
+    limit_req_zone $binary_remote_addr zone=api-0:10m rate=10r/s;
+    upstream api {
+        server api:8080;
+    }
+
+    server {
+        listen 80;
+        server_name test.example.com;
+        return 301 https://$server_name$request_uri;
+    }
+
+    server {
+        listen 443 ssl;
+        http2 on;
+        server_name test.example.com;
+
+        ssl_certificate /etc/nginx/ssl/test.example.com.crt;
+        ssl_certificate_key /etc/nginx/ssl/test.example.com.key;
+        ssl_protocols TLSv1.2 TLSv1.3;
+        ssl_prefer_server_ciphers on;
+        add_header X-Frame-Options DENY;
+        location /api {
+            client_max_body_size 50m;
+            proxy_read_timeout 120s;
+            proxy_http_version 1.1;
+            proxy_set_header Upgrade $http_upgrade;
+            proxy_set_header Connection $ftl_connection_upgrade;
+            proxy_set_header X-Real-IP "$remote_addr";
+            add_header Cache-Control "no-store, \"private\"" always;
+            auth_basic "Restricted";
+            auth_basic_user_file /etc/nginx/conf.d/api-0.htpasswd;
+            allow 10.0.0.0/8;
+            deny all;
+            limit_req zone=api-0 burst=20 nodelay;
+            if ($request_method = OPTIONS) {
+                return 204;
+            }
+            resolver 127.0.0.11 valid=1s;
+            set $service api;
+            proxy_pass http://$service;
+        }
+    }
+`
+
+	nginxConfig, err := GenerateNginxConfig(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stripWhitespace(expectedConfig), stripWhitespace(nginxConfig))
+
+	htpasswdFiles := GenerateHtpasswdFiles(cfg)
+
+	assert.Equal(suite.T(), map[string]string{"api-0.htpasswd": "admin:$apr1$abc$xyz\n"}, htpasswdFiles)
+}
+
+func (suite *ProxyTestSuite) TestGenerateNginxConfig_OwnCertificate() {
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		TLS: config.TLS{
+			Mode: "dns",
+			DNS: &config.DNSChallenge{
+				Provider: "file",
+				Wildcard: true,
+			},
+		},
+	}
+
+	expectedConfig := `
+    server {
+        listen 80;
+        server_name test.example.com *.test.example.com;
+        return 301 https://$host$request_uri;
+    }
+
+    server {
+        listen 443 ssl;
+        http2 on;
+        server_name test.example.com *.test.example.com;
+
+        ssl_certificate /etc/nginx/ssl/certs/test.example.com.crt;
+        ssl_certificate_key /etc/nginx/ssl/certs/test.example.com.key;
+        ssl_protocols TLSv1.2 TLSv1.3;
+        ssl_prefer_server_ciphers on;
+    }
+`
+
+	nginxConfig, err := GenerateNginxConfig(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stripWhitespace(expectedConfig), stripWhitespace(nginxConfig))
+}
+
+func (suite *ProxyTestSuite) TestGenerateNginxConfig_Static() {
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		Static: []config.Static{
+			{
+				Name:        "frontend",
+				PathPrefix:  "/",
+				SPA:         true,
+				CacheMaxAge: time.Hour,
+			},
+			{
+				Name:        "docs",
+				PathPrefix:  "/docs/",
+				CacheMaxAge: 24 * time.Hour,
+			},
+		},
+	}
+
+	expectedConfig := `
+    map $sent_http_content_type $ftl_static_cache_0 {
+        default "public, max-age=3600";
+        ~^text/html "no-cache";
+    }
+    map $sent_http_content_type $ftl_static_cache_1 {
+        default "public, max-age=86400";
+        ~^text/html "no-cache";
+    }
+
+    server {
+        listen 80;
+        server_name test.example.com;
+        return 301 https://$server_name$request_uri;
+    }
+
+    server {
+        listen 443 ssl;
+        http2 on;
+        server_name test.example.com;
+
+        ssl_certificate /etc/nginx/ssl/test.example.com.crt;
+        ssl_certificate_key /etc/nginx/ssl/test.example.com.key;
+        ssl_protocols TLSv1.2 TLSv1.3;
+        ssl_prefer_server_ciphers on;
+
+        location / {
+            root /srv/static/frontend/current;
+            try_files $uri $uri/ /index.html;
+            add_header Cache-Control $ftl_static_cache_0 always;
+        }
+
+        location = /docs {
+            return 301 /docs/;
+        }
+
+        location /docs/ {
+            alias /srv/static/docs/current/;
+            try_files $uri $uri/ =404;
+            add_header Cache-Control $ftl_static_cache_1 always;
+        }
+    }
+`
+
+	nginxConfig, err := GenerateNginxConfig(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stripWhitespace(expectedConfig), stripWhitespace(nginxConfig))
+
+	service := (&Nginx{}).Service(cfg, "/home/deploy/projects/test-project")
+	assert.Contains(suite.T(), service.Volumes, bind("/home/deploy/projects/test-project/static", "/srv/static", true))
+}
+
+func (suite *ProxyTestSuite) TestGenerateCaddyfile_Static() {
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		Proxy: config.Proxy{
+			Type: "caddy",
+		},
+		Static: []config.Static{
+			{
+				Name:        "docs",
+				PathPrefix:  "/docs",
+				SPA:         true,
+				CacheMaxAge: time.Hour,
+			},
+		},
+	}
+
+	expectedConfig := `
+{
+	email test@example.com
+}
+
+test.example.com {
+
+	handle /docs* {
+		uri strip_prefix /docs
+		root * /ftl/static/docs/current
+		@docs_pages path_regexp (^|/)[^./]*$|\.html$
+		@docs_assets not path_regexp (^|/)[^./]*$|\.html$
+		header @docs_pages Cache-Control "no-cache"
+		header @docs_assets Cache-Control "public, max-age=3600"
+		try_files {path} /index.html
+		file_server
+	}
+}
+`
+
+	caddyfile, err := GenerateCaddyfile(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stripWhitespace(expectedConfig), stripWhitespace(caddyfile))
+}
+
+func (suite *ProxyTestSuite) TestGenerateCaddyfile() {
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		Proxy: config.Proxy{
+			Type: "caddy",
+		},
+		Services: []config.Service{
+			{
+				Name:  "web",
+				Image: "nginx:latest",
+				Port:  80,
+				Routes: []config.Route{
+					{
+						PathPrefix: "/",
+					},
+				},
+			},
+			{
+				Name:  "api",
+				Image: "api:latest",
+				Port:  8080,
+				Routes: []config.Route{
+					{
+						PathPrefix:        "/api",
+						StripPrefix:       true,
+						ClientMaxBodySize: "50m",
+						ProxyReadTimeout:  "2m",
+						RequestHeaders: map[string]string{
+							"X-Env": "prod",
+						},
+						ResponseHeaders: map[string]string{
+							"Cache-Control": "no-store",
+						},
+						BasicAuth: &config.BasicAuth{
+							Users: []string{"admin:$2a$14$hash"},
+						},
+						Allow: []string{"10.0.0.0/8"},
+						Deny:  []string{"all"},
+					},
+				},
+			},
+		},
+	}
+
+	expectedConfig := `
+{
+	email test@example.com
+}
+
+test.example.com {
+
+	handle /* {
+		reverse_proxy web:80
+	}
+
+	handle /api* {
+		uri strip_prefix /api
+		@denied not remote_ip 10.0.0.0/8
+		respond @denied 403
+		basic_auth bcrypt "Restricted" {
+			admin $2a$14$hash
+		}
+		request_body {
+			max_size 50MB
+		}
+		header Cache-Control "no-store"
+		reverse_proxy api:8080 {
+			header_up X-Env "prod"
+			transport http {
+				read_timeout 2m0s
+			}
+		}
+	}
+}
+`
+
+	caddyfile, err := GenerateCaddyfile(cfg)
+
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stripWhitespace(expectedConfig), stripWhitespace(caddyfile))
+}
+
+func (suite *ProxyTestSuite) TestNewBackend() {
+	backend, err := NewBackend(&config.Config{})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "nginx", backend.Name())
+
+	backend, err = NewBackend(&config.Config{Proxy: config.Proxy{Type: "caddy"}})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "caddy", backend.Name())
+
+	cfg := &config.Config{
+		Project: config.Project{Domain: "test.example.com"},
+		Proxy:   config.Proxy{Type: "caddy"},
+		TLS:     config.TLS{Mode: "custom"},
+	}
+	certificate, key := backend.CertificatePaths(cfg)
+	assert.Equal(suite.T(), "/ftl/certs/test.example.com.crt", certificate)
+	assert.Equal(suite.T(), "/ftl/certs/test.example.com.key", key)
+
+	_, err = NewBackend(&config.Config{Proxy: config.Proxy{Type: "haproxy"}})
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ProxyTestSuite) TestBackendService_Overrides() {
+	enabled := true
+	cfg := &config.Config{
+		Project: config.Project{
+			Name:   "test-project",
+			Domain: "test.example.com",
+			Email:  "test@example.com",
+		},
+		Proxy: config.Proxy{
+			Enabled:     &enabled,
+			Image:       "registry.example.com/zero-nginx:1.2",
+			HTTPPort:    8080,
+			HTTPSPort:   8443,
+			BindAddress: "10.0.0.5",
+			Volumes:     []config.Mount{bind("/srv/static", "/usr/share/nginx/html", true)},
+			EnvVars:     map[string]string{"TZ": "UTC"},
+			Memory:      "256m",
+			CPUs:        "0.5",
+		},
+		Services: []config.Service{
+			{
+				Name:       "mqtt",
+				Port:       1883,
+				Protocol:   "tcp",
+				PublicPort: 1883,
+			},
+		},
+	}
+
+	service := (&Nginx{}).Service(cfg, "/home/deploy/projects/test-project")
+
+	assert.Equal(suite.T(), "registry.example.com/zero-nginx:1.2", service.Image)
+	assert.Equal(suite.T(), []string{
+		"10.0.0.5:8080:80",
+		"10.0.0.5:8443:443",
+		"10.0.0.5:1883:1883",
+	}, service.Forwards)
+	assert.Contains(suite.T(), service.Volumes, bind("/srv/static", "/usr/share/nginx/html", true))
+	assert.Equal(suite.T(), "UTC", service.EnvVars["TZ"])
+	assert.Equal(suite.T(), "test.example.com", service.EnvVars["DOMAIN"])
+	assert.Equal(suite.T(), "256m", service.Memory)
+	assert.Equal(suite.T(), "0.5", service.CPUs)
+	assert.NotNil(suite.T(), service.HealthCheck)
+}
@@ -30,7 +30,7 @@ func DockerLogin(ctx context.Context, dockerUsername, dockerPassword string) err
 	return nil
 }
 
-func RunSetup(ctx context.Context, server config.Server, sshKeyPath, dockerUsername, dockerPassword, newUserPassword string) error {
+func RunSetup(ctx context.Context, cfg *config.Config, server config.Server, sshKeyPath, dockerUsername, dockerPassword, newUserPassword string) error {
 	client, rootKey, err := sshPkg.FindKeyAndConnectWithUser(server.Host, server.Port, "root", sshKeyPath)
 	if err != nil {
 		return fmt.Errorf("failed to find a suitable SSH key and connect to the server: %w", err)
@@ -42,7 +42,7 @@ func RunSetup(ctx context.Context, server config.Server, sshKeyPath, dockerUsern
 		return err
 	}
 
-	if err := configureServerFirewall(ctx, client); err != nil {
+	if err := configureServerFirewall(ctx, client, cfg); err != nil {
 		return err
 	}
 
@@ -87,17 +87,30 @@ func installServerSoftware(ctx context.Context, client *sshPkg.Client) error {
 	)
 }
 
-func configureServerFirewall(ctx context.Context, client *sshPkg.Client) error {
+func configureServerFirewall(ctx context.Context, client *sshPkg.Client, cfg *config.Config) error {
 	commands := []string{
 		"apt-get install -y ufw",
 		"ufw default deny incoming",
 		"ufw default allow outgoing",
 		"ufw allow 22/tcp",
-		"ufw allow 80/tcp",
-		"ufw allow 443/tcp",
-		"echo 'y' | ufw enable",
 	}
 
+	if cfg.Proxy.IsEnabled() {
+		httpPort, httpsPort := cfg.Proxy.Ports()
+		commands = append(commands,
+			fmt.Sprintf("ufw allow %d/tcp", httpPort),
+			fmt.Sprintf("ufw allow %d/tcp", httpsPort),
+		)
+
+		for _, service := range cfg.Services {
+			if service.IsStream() {
+				commands = append(commands, fmt.Sprintf("ufw allow %d/%s", service.PublicPort, service.Protocol))
+			}
+		}
+	}
+
+	commands = append(commands, "echo 'y' | ufw enable")
+
 	return client.RunCommandWithProgress(
 		ctx,
 		"Configuring server firewall...",